@@ -0,0 +1,214 @@
+package apps
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/details"
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+// The stored installed apps of all devices
+var oldApps map[string][]models.InstalledApp
+
+// The devices that were already synced before
+var knownDevices map[string]bool
+
+// All app changes of the current sync
+var appChanges []models.AppChange
+
+// Prepares the app changes synchronization
+func StartSync(ctx context.Context, database *database.Database) {
+	appChanges = []models.AppChange{}
+
+	var err error
+	knownDevices = map[string]bool{}
+	oldApps, err = details.GetInstalledApps(ctx, database)
+	if err != nil {
+		log.Warnf("Error during fetching old installed apps: %v", err)
+		oldApps = map[string][]models.InstalledApp{}
+		return
+	}
+	// Devices are known by their stored details, because devices without apps have no stored apps
+	oldDetails, err := details.GetAllDetails(ctx, database)
+	if err != nil {
+		log.Warnf("Error during fetching old device details: %v", err)
+		return
+	}
+	for id := range oldDetails {
+		knownDevices[id] = true
+	}
+}
+
+// Compares the installed apps of the device with the stored ones
+func SyncDevice(device *models.GeneralDevice, rDevice *models.RelutionDevice) {
+	// On the first sync of a device all apps would be marked as installed,
+	// so the first inventory of a device is not recorded as changes
+	if !knownDevices[device.Id] {
+		return
+	}
+	appChanges = append(appChanges, getAppChanges(oldApps[device.Id], models.RelutionDeviceToInstalledApps(device.Id, *rDevice), time.Now())...)
+}
+
+// Stores all app changes of the sync
+func EndSync(ctx context.Context, database *database.Database) error {
+	if len(appChanges) == 0 {
+		return nil
+	}
+	log.Infof("Add %d app changes...", len(appChanges))
+	var lastErr error
+	failed := 0
+	for _, change := range appChanges {
+		_, err := database.DB.ExecContext(ctx,
+			"INSERT INTO app_changes VALUES (?, ?, ?, ?, ?, ?, ?)",
+			change.Id,
+			change.Identifier,
+			change.Name,
+			change.Change,
+			change.OldVersion,
+			change.NewVersion,
+			change.Timestamp.UTC().Format(helper.SqlDateFormat),
+		)
+		if err != nil {
+			log.Warnf("Error adding app change: %v", err)
+			lastErr = err
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("error adding %d of %d app changes: %v", failed, len(appChanges), lastErr)
+	}
+	return nil
+}
+
+// Returns all installed, removed and updated apps
+func getAppChanges(oldApps []models.InstalledApp, newApps []models.InstalledApp, timestamp time.Time) []models.AppChange {
+	changes := []models.AppChange{}
+	old := map[string]models.InstalledApp{}
+	for _, app := range oldApps {
+		old[app.Identifier] = app
+	}
+	for _, app := range newApps {
+		oldApp, exists := old[app.Identifier]
+		if !exists {
+			changes = append(changes, models.AppChange{Id: app.Id, Identifier: app.Identifier, Name: app.Name, Change: installedChange, NewVersion: app.AppVersion(), Timestamp: timestamp})
+		} else if oldApp.AppVersion() != app.AppVersion() {
+			changes = append(changes, models.AppChange{Id: app.Id, Identifier: app.Identifier, Name: app.Name, Change: updatedChange, OldVersion: oldApp.AppVersion(), NewVersion: app.AppVersion(), Timestamp: timestamp})
+		}
+		delete(old, app.Identifier)
+	}
+	for _, app := range old {
+		changes = append(changes, models.AppChange{Id: app.Id, Identifier: app.Identifier, Name: app.Name, Change: removedChange, OldVersion: app.AppVersion(), Timestamp: timestamp})
+	}
+	return changes
+}
+
+// GetMissingApps returns all devices without one of the required apps
+func GetMissingApps(ctx context.Context, database *database.Database, config *config.Config, devices []models.GeneralDevice) ([]models.AppReportEntry, error) {
+	installedApps, err := details.GetInstalledApps(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []models.AppReportEntry{}
+	for _, device := range devices {
+		for _, required := range config.Apps.Required {
+			if findApp(installedApps[device.Id], required.Identifier) == nil {
+				entries = append(entries, models.AppReportEntry{Device: device, Identifier: required.Identifier, RequiredVersion: required.MinVersion})
+			}
+		}
+	}
+	return entries, nil
+}
+
+// GetOutdatedApps returns all devices with a required app older than the required version
+func GetOutdatedApps(ctx context.Context, database *database.Database, config *config.Config, devices []models.GeneralDevice) ([]models.AppReportEntry, error) {
+	installedApps, err := details.GetInstalledApps(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []models.AppReportEntry{}
+	for _, device := range devices {
+		for _, required := range config.Apps.Required {
+			app := findApp(installedApps[device.Id], required.Identifier)
+			if app == nil || required.MinVersion == "" {
+				continue
+			}
+			compared, err := helper.CompareVersions(app.AppVersion(), required.MinVersion)
+			if err != nil {
+				log.Warnf("Cannot compare version of %s on device %s: %v", app.Identifier, device.Id, err)
+				continue
+			}
+			if compared < 0 {
+				entries = append(entries, models.AppReportEntry{Device: device, Identifier: app.Identifier, Name: app.Name, Version: app.AppVersion(), RequiredVersion: required.MinVersion})
+			}
+		}
+	}
+	return entries, nil
+}
+
+// GetAvailableUpdates returns all apps on all devices with an available update
+func GetAvailableUpdates(ctx context.Context, database *database.Database, devices []models.GeneralDevice) ([]models.AppReportEntry, error) {
+	installedApps, err := details.GetInstalledApps(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []models.AppReportEntry{}
+	for _, device := range devices {
+		for _, app := range installedApps[device.Id] {
+			if app.HasUpdateAvailable {
+				entries = append(entries, models.AppReportEntry{Device: device, Identifier: app.Identifier, Name: app.Name, Version: app.AppVersion()})
+			}
+		}
+	}
+	return entries, nil
+}
+
+// GetAppChanges returns all app changes of the device since the given date, newest first
+func GetAppChanges(ctx context.Context, database *database.Database, id string, from time.Time) ([]models.AppChange, error) {
+	rows, _err := database.DB.QueryContext(ctx, "SELECT * FROM app_changes WHERE id = ? AND timestamp >= ? ORDER BY timestamp DESC", id, from.UTC().Format(helper.SqlDateFormat))
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	changes := []models.AppChange{}
+	for rows.Next() {
+		change := models.AppChange{}
+		var timestamp mysql.NullTime
+		err := rows.Scan(&change.Id, &change.Identifier, &change.Name, &change.Change, &change.OldVersion, &change.NewVersion, &timestamp)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		if timestamp.Valid {
+			change.Timestamp = timestamp.Time
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return changes, nil
+}
+
+func findApp(apps []models.InstalledApp, identifier string) *models.InstalledApp {
+	for _, app := range apps {
+		if app.Identifier == identifier {
+			return &app
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package apps
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/export"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+func Serve(root *gin.RouterGroup, database *database.Database, getConfig func() *config.Config, getDevices func(context.Context, *database.Database) (*[]models.GeneralDevice, error)) {
+	root.GET("/apps/missing", func(c *gin.Context) {
+		devices, err := getDevices(c.Request.Context(), database)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		entries, err := GetMissingApps(c.Request.Context(), database, getConfig(), *devices)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "apps", entries)
+	})
+
+	root.GET("/apps/outdated", func(c *gin.Context) {
+		devices, err := getDevices(c.Request.Context(), database)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		entries, err := GetOutdatedApps(c.Request.Context(), database, getConfig(), *devices)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "apps", entries)
+	})
+
+	root.GET("/apps/updates", func(c *gin.Context) {
+		devices, err := getDevices(c.Request.Context(), database)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		entries, err := GetAvailableUpdates(c.Request.Context(), database, *devices)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "apps", entries)
+	})
+
+	root.GET("/devices/:id/apps/changes", func(c *gin.Context) {
+		request := ChangesRequest{}
+		if err := c.ShouldBindQuery(&request); err != nil {
+			c.JSON(400, gin.H{"error": "Wrong query format"})
+			return
+		}
+		changes, err := GetAppChanges(c.Request.Context(), database, c.Param("id"), request.From)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "changes", changes)
+	})
+}
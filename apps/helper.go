@@ -0,0 +1,14 @@
+package apps
+
+import "time"
+
+// The types of app changes
+const (
+	installedChange = "installed"
+	removedChange   = "removed"
+	updatedChange   = "updated"
+)
+
+type ChangesRequest struct {
+	From time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+}
@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/viktoriaschule/management-server/auth"
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+// Middleware records every request with the authenticated user, the route,
+// the parameters and the response status
+func Middleware(database *database.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		params := requestParams(c)
+
+		c.Next()
+
+		username := ""
+		if user := auth.GetUser(c); user != nil {
+			username = user.Username
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+
+		addEntry(database, &models.AuditEntry{
+			Timestamp: start,
+			Username:  username,
+			Type:      requestType,
+			Method:    c.Request.Method,
+			Route:     route,
+			Params:    params,
+			Status:    c.Writer.Status(),
+			Duration:  time.Since(start).Milliseconds(),
+		})
+	}
+}
+
+// RecordAction adds an administrative action of the given user to the audit log
+func RecordAction(database *database.Database, username string, action string, details interface{}) {
+	params, err := json.Marshal(details)
+	if err != nil {
+		log.Warnf("Error encoding audit action details: %v", err)
+	}
+	addEntry(database, &models.AuditEntry{
+		Timestamp: time.Now(),
+		Username:  username,
+		Type:      actionType,
+		Route:     action,
+		Params:    string(params),
+	})
+}
+
+// Returns the path parameters, the query and the size and content type of the body of a request as json,
+// the body itself is neither read nor stored, because it may contain credentials or personal data
+func requestParams(c *gin.Context) string {
+	params := map[string]interface{}{}
+
+	for _, param := range c.Params {
+		params[param.Key] = param.Value
+	}
+	if query := c.Request.URL.Query(); len(query) > 0 {
+		params["query"] = query
+	}
+
+	// The body size limit sets the length of chunked bodies, so it is only unknown without that limit
+	if c.Request.ContentLength != 0 {
+		params["bodySize"] = c.Request.ContentLength
+		params["contentType"] = c.ContentType()
+	}
+
+	if len(params) == 0 {
+		return ""
+	}
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		log.Warnf("Error encoding audit request params: %v", err)
+		return ""
+	}
+	return string(encoded)
+}
+
+// Adds the entry to the database
+func addEntry(database *database.Database, entry *models.AuditEntry) {
+	_, err := database.DB.Exec(
+		"INSERT INTO audit_log (timestamp, username, type, method, route, params, status, duration) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.Timestamp.UTC().Format(helper.SqlDateFormat),
+		entry.Username,
+		entry.Type,
+		entry.Method,
+		entry.Route,
+		entry.Params,
+		entry.Status,
+		entry.Duration,
+	)
+	if err != nil {
+		log.Warnf("Error adding audit entry: %v", err)
+	}
+}
+
+// RemoveOldEntries removes all audit entries older than the configured retention
+func RemoveOldEntries(ctx context.Context, database *database.Database, config *config.Config) error {
+	days := config.Audit.RetentionDays
+	if days <= 0 {
+		days = defaultRetentionDays
+	}
+	oldestDate := time.Now().UTC().AddDate(0, 0, -days).Format(helper.SqlDateFormat)
+	log.Debugf("Remove audit entries older than %s...", oldestDate)
+	_, err := database.DB.ExecContext(ctx, "DELETE FROM audit_log WHERE timestamp < ?", oldestDate)
+
+	if err != nil {
+		log.Warnf("Error deleting old audit entries: %v", err)
+		return fmt.Errorf("error deleting old audit entries: %v", err)
+	}
+	return nil
+}
+
+// GetEntries returns all audit entries matching the filter, newest first
+func GetEntries(ctx context.Context, database *database.Database, filter Filter) (entries []models.AuditEntry, err error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Username != "" {
+		conditions = append(conditions, "username = ?")
+		args = append(args, filter.Username)
+	}
+	if filter.Route != "" {
+		conditions = append(conditions, "route = ?")
+		args = append(args, filter.Route)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, filter.From.UTC().Format(helper.SqlDateFormat))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "timestamp <= ?")
+		args = append(args, filter.To.UTC().Format(helper.SqlDateFormat))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ") + " "
+	}
+	limit := filter.Limit
+	if limit <= 0 || limit > maxQueryLimit {
+		limit = maxQueryLimit
+	}
+	args = append(args, limit)
+
+	rows, _err := database.DB.QueryContext(ctx, "SELECT id, timestamp, username, type, method, route, params, status, duration FROM audit_log "+where+"ORDER BY timestamp DESC, id DESC LIMIT ?", args...)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	entries = []models.AuditEntry{}
+	for rows.Next() {
+		entry := models.AuditEntry{}
+		var timestamp mysql.NullTime
+		err := rows.Scan(&entry.Id, &timestamp, &entry.Username, &entry.Type, &entry.Method, &entry.Route, &entry.Params, &entry.Status, &entry.Duration)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		if timestamp.Valid {
+			entry.Timestamp = timestamp.Time
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return entries, nil
+}
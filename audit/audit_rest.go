@@ -0,0 +1,24 @@
+package audit
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/export"
+)
+
+func Serve(admin *gin.RouterGroup, database *database.Database) {
+	admin.GET("/audit", func(c *gin.Context) {
+		filter := Filter{}
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(400, gin.H{"error": "Wrong query format"})
+			return
+		}
+		entries, err := GetEntries(c.Request.Context(), database, filter)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "entries", entries)
+	})
+}
@@ -0,0 +1,23 @@
+package audit
+
+import "time"
+
+// The audit entry types
+const (
+	requestType = "request"
+	actionType  = "action"
+)
+
+// The default duration to store audit entries (90d)
+const defaultRetentionDays = 90
+
+// The max count of entries returned by one query
+const maxQueryLimit = 1000
+
+type Filter struct {
+	Username string    `form:"user"`
+	Route    string    `form:"route"`
+	From     time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To       time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit    int       `form:"limit"`
+}
@@ -1,28 +1,38 @@
 package auth
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 
 	"github.com/viktoriaschule/management-server/config"
-	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/metrics"
 )
 
-func CheckUser(username, password string, config *config.Config) (bool, error) {
+// The key of the authenticated user in the gin context
+const userKey = "user"
+
+// CheckUser checks the credentials against the ldap API and returns the user,
+// or nil when the credentials are wrong
+func CheckUser(ctx context.Context, username, password string, config *config.Config) (*User, error) {
 	client := &http.Client{}
-	request, err := http.NewRequest("GET", config.Ldap.Url, nil)
+	request, err := http.NewRequestWithContext(ctx, "GET", config.LdapUrl(), nil)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	request.Header.Add("Authorization", "Basic "+basicAuth(username, password))
+	start := time.Now()
 	response, err := client.Do(request)
+	metrics.LdapDuration.ObserveSince(start)
 	if err != nil {
-		return false, errors.Wrap(err, "failed requesting ldap API")
+		metrics.LdapFailures.Inc("error")
+		return nil, errors.Wrap(err, "failed requesting ldap API")
 	}
 	//noinspection GoUnhandledErrorResult
 	defer response.Body.Close()
@@ -30,15 +40,49 @@ func CheckUser(username, password string, config *config.Config) (bool, error) {
 		var ldapResponse LdapResponse
 		err = json.NewDecoder(response.Body).Decode(&ldapResponse)
 		if err != nil {
-			log.Errorf("Error parsing json: %v", err)
-			os.Exit(1)
+			// Also fails if the request was canceled while reading the body
+			metrics.LdapFailures.Inc("error")
+			return nil, errors.Wrap(err, "failed parsing ldap response")
+		}
+		if !ldapResponse.Status {
+			metrics.LdapFailures.Inc("rejected")
+			return nil, nil
 		}
-		return ldapResponse.Status, nil
+		return &User{
+			Username:  username,
+			Grade:     ldapResponse.Grade,
+			IsTeacher: ldapResponse.IsTeacher,
+			IsAdmin:   isAdmin(username, config),
+		}, nil
 	}
 	if response.StatusCode == http.StatusUnauthorized {
-		return false, nil
+		metrics.LdapFailures.Inc("rejected")
+		return nil, nil
+	}
+	metrics.LdapFailures.Inc("error")
+	return nil, errors.New(fmt.Sprintf("requesting ldap authentication failed with status code %d", response.StatusCode))
+}
+
+// SetUser stores the authenticated user in the request context
+func SetUser(c *gin.Context, user *User) {
+	c.Set(userKey, user)
+}
+
+// GetUser returns the authenticated user of the request, or nil if there is none
+func GetUser(c *gin.Context) *User {
+	if user, exists := c.Get(userKey); exists {
+		return user.(*User)
 	}
-	return false, errors.New(fmt.Sprintf("requesting ldap authentication failed with status code %d", response.StatusCode))
+	return nil
+}
+
+func isAdmin(username string, config *config.Config) bool {
+	for _, admin := range config.Admins {
+		if admin == username {
+			return true
+		}
+	}
+	return false
 }
 
 func basicAuth(username, password string) string {
@@ -51,3 +95,10 @@ type LdapResponse struct {
 	Grade     string
 	IsTeacher bool
 }
+
+type User struct {
+	Username  string `json:"username"`
+	Grade     string `json:"grade"`
+	IsTeacher bool   `json:"is_teacher"`
+	IsAdmin   bool   `json:"is_admin"`
+}
@@ -0,0 +1,166 @@
+package changes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+// The last tracked state of all devices
+var oldSnapshots map[string]models.TrackedDevice
+
+// The changed tracked states and field changes of the current sync
+var changedSnapshots map[string]models.TrackedDevice
+var fieldChanges []models.DeviceChange
+
+// Prepares the device changes synchronization
+func StartSync(ctx context.Context, database *database.Database) {
+	changedSnapshots = map[string]models.TrackedDevice{}
+	fieldChanges = []models.DeviceChange{}
+
+	var err error
+	oldSnapshots, err = getSnapshots(ctx, database)
+	if err != nil {
+		log.Warnf("Error during fetching old device snapshots: %v", err)
+		oldSnapshots = nil
+	}
+}
+
+// Compares all tracked fields of the device with the last tracked state
+func SyncDevice(device *models.GeneralDevice, rDevice *models.RelutionDevice) {
+	// Without the old snapshots all devices would be recorded as new
+	if oldSnapshots == nil {
+		return
+	}
+	snapshot := models.DeviceToTrackedDevice(device, rDevice)
+	old, exists := oldSnapshots[device.Id]
+	if !exists {
+		changedSnapshots[device.Id] = *snapshot
+		return
+	}
+
+	timestamp := time.Now()
+	changes := models.GetChangedFields(old, *snapshot)
+	for _, change := range changes {
+		fieldChanges = append(fieldChanges, models.DeviceChange{Id: device.Id, FieldChange: change, Timestamp: timestamp})
+	}
+	if len(changes) > 0 {
+		changedSnapshots[device.Id] = *snapshot
+	}
+}
+
+// Stores all field changes and the changed tracked states
+func EndSync(ctx context.Context, database *database.Database) error {
+	var lastErr error
+	failed := 0
+	if len(fieldChanges) > 0 {
+		log.Infof("Add %d device changes...", len(fieldChanges))
+		values := make([]string, 0, len(fieldChanges))
+		args := make([]interface{}, 0, len(fieldChanges)*5)
+		for _, change := range fieldChanges {
+			values = append(values, "(?, ?, ?, ?, ?)")
+			args = append(args, change.Id, change.Field, change.OldValue, change.NewValue, change.Timestamp.UTC().Format(helper.SqlDateFormat))
+		}
+		if _, err := database.DB.ExecContext(ctx, "INSERT INTO device_changes VALUES "+strings.Join(values, ", "), args...); err != nil {
+			log.Warnf("Error adding device changes: %v", err)
+			return fmt.Errorf("error adding %d device changes: %v", len(fieldChanges), err)
+		}
+	}
+
+	for id, snapshot := range changedSnapshots {
+		encoded, err := json.Marshal(snapshot)
+		if err != nil {
+			log.Warnf("Error encoding device snapshot: %v", err)
+			lastErr = err
+			failed++
+			continue
+		}
+		if _, err = database.DB.ExecContext(ctx, "REPLACE INTO device_snapshots VALUES (?, ?)", id, string(encoded)); err != nil {
+			log.Warnf("Error updating device snapshot: %v", err)
+			lastErr = err
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("error updating %d of %d device snapshots: %v", failed, len(changedSnapshots), lastErr)
+	}
+	return nil
+}
+
+// GetTimeline returns all field changes of the device since the given date, newest first,
+// if a field is given, only the changes of this field
+func GetTimeline(ctx context.Context, database *database.Database, id string, from time.Time, field string) ([]models.DeviceChange, error) {
+	query := "SELECT * FROM device_changes WHERE id = ? AND timestamp >= ?"
+	args := []interface{}{id, from.UTC().Format(helper.SqlDateFormat)}
+	if field != "" {
+		query += " AND field = ?"
+		args = append(args, field)
+	}
+	rows, _err := database.DB.QueryContext(ctx, query+" ORDER BY timestamp DESC", args...)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	changes := []models.DeviceChange{}
+	for rows.Next() {
+		change := models.DeviceChange{}
+		var timestamp mysql.NullTime
+		err := rows.Scan(&change.Id, &change.Field, &change.OldValue, &change.NewValue, &timestamp)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		if timestamp.Valid {
+			change.Timestamp = timestamp.Time
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return changes, nil
+}
+
+// Returns the last tracked state of all devices
+func getSnapshots(ctx context.Context, database *database.Database) (map[string]models.TrackedDevice, error) {
+	rows, _err := database.DB.QueryContext(ctx, "SELECT * FROM device_snapshots")
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	snapshots := map[string]models.TrackedDevice{}
+	for rows.Next() {
+		var id, encoded string
+		if err := rows.Scan(&id, &encoded); err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		snapshot := models.TrackedDevice{}
+		if err := json.Unmarshal([]byte(encoded), &snapshot); err != nil {
+			log.Warnf("Cannot read snapshot of device %s: %v", id, err)
+			continue
+		}
+		snapshots[id] = snapshot
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,24 @@
+package changes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/export"
+)
+
+func Serve(root *gin.RouterGroup, database *database.Database) {
+	root.GET("/devices/:id/changes", func(c *gin.Context) {
+		request := TimelineRequest{}
+		if err := c.ShouldBindQuery(&request); err != nil {
+			c.JSON(400, gin.H{"error": "Wrong query format"})
+			return
+		}
+		changes, err := GetTimeline(c.Request.Context(), database, c.Param("id"), request.From, request.Field)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "changes", changes)
+	})
+}
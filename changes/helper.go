@@ -0,0 +1,8 @@
+package changes
+
+import "time"
+
+type TimelineRequest struct {
+	From  time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	Field string    `form:"field"`
+}
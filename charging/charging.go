@@ -1,6 +1,7 @@
 package charging
 
 import (
+	"context"
 	"time"
 
 	"github.com/viktoriaschule/management-server/database"
@@ -15,10 +16,10 @@ const maxLoadingDuration = time.Minute * 15
 var currentLoadingEntries map[string][]models.HistoryEntry
 
 // Prepares the device charging synchronization
-func StartSync(database *database.Database, getHistoryEntriesInDuration func(*database.Database, time.Duration) (map[string][]models.HistoryEntry, error)) {
+func StartSync(ctx context.Context, database *database.Database, getHistoryEntriesInDuration func(context.Context, *database.Database, time.Duration) (map[string][]models.HistoryEntry, error)) {
 
 	var err error
-	currentLoadingEntries, err = getHistoryEntriesInDuration(database, maxLoadingDuration)
+	currentLoadingEntries, err = getHistoryEntriesInDuration(ctx, database, maxLoadingDuration)
 
 	if err != nil {
 		log.Errorf("Cannot load current loading entries: %v", err)
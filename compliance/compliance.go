@@ -0,0 +1,188 @@
+package compliance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+// The stored compliance states of all devices
+var oldStates map[string]models.ComplianceState
+
+// The changed compliance states of the current sync
+var changedStates []models.ComplianceState
+
+// Prepares the compliance synchronization
+func StartSync(ctx context.Context, database *database.Database) {
+	changedStates = []models.ComplianceState{}
+
+	var err error
+	oldStates, err = GetStates(ctx, database)
+	if err != nil {
+		log.Warnf("Error during fetching old compliance states: %v", err)
+		oldStates = map[string]models.ComplianceState{}
+	}
+}
+
+// Compares the policies and compliance counts of the device with the stored ones
+func SyncDevice(device *models.GeneralDevice, rDevice *models.RelutionDevice) {
+	state := models.RelutionDeviceToComplianceState(device.Id, *rDevice)
+	old, exists := oldStates[device.Id]
+	if exists && old.CompliancePolicy == state.CompliancePolicy {
+		return
+	}
+
+	// Keep the start of the violation while the device is still violating
+	if state.IsViolating() {
+		if exists && old.IsViolating() && old.ViolatingSince != nil {
+			state.ViolatingSince = old.ViolatingSince
+		} else {
+			state.ViolatingSince = &state.Timestamp
+		}
+	}
+	changedStates = append(changedStates, *state)
+}
+
+// Stores all changed compliance states and adds them to the compliance history
+func EndSync(ctx context.Context, database *database.Database) error {
+	var lastErr error
+	failed := 0
+	for _, state := range changedStates {
+		var violatingSince interface{}
+		if state.ViolatingSince != nil {
+			violatingSince = state.ViolatingSince.UTC().Format(helper.SqlDateFormat)
+		}
+		values := []interface{}{
+			state.Id,
+			state.ExecutedPolicyName,
+			state.ExecutedPolicyVersion,
+			state.ExecutedPolicyState,
+			state.PolicyName,
+			state.PolicyVersion,
+			state.PolicyState,
+			state.RulesetName,
+			state.RulesetVersion,
+			state.NoticeCount,
+			state.ViolatedCount,
+			violatingSince,
+			state.Timestamp.UTC().Format(helper.SqlDateFormat),
+		}
+		if _, err := database.DB.ExecContext(ctx, "REPLACE INTO compliance_states VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", values...); err != nil {
+			log.Warnf("Error updating compliance state: %v", err)
+			lastErr = err
+			failed++
+		}
+		if _, err := database.DB.ExecContext(ctx, "INSERT INTO compliance_history VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", values...); err != nil {
+			log.Warnf("Error adding compliance history entry: %v", err)
+			lastErr = err
+			failed++
+		}
+	}
+	if len(changedStates) > 0 {
+		log.Infof("Updated %d compliance states", len(changedStates))
+	}
+	if failed > 0 {
+		return fmt.Errorf("error updating %d compliance states or history entries: %v", failed, lastErr)
+	}
+	return nil
+}
+
+// GetViolatingDevices returns all devices with compliance violations, longest violating first
+func GetViolatingDevices(ctx context.Context, database *database.Database, devices []models.GeneralDevice) ([]models.ComplianceReportEntry, error) {
+	states, err := GetStates(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entries := []models.ComplianceReportEntry{}
+	for _, device := range devices {
+		state, exists := states[device.Id]
+		if !exists || !state.IsViolating() {
+			continue
+		}
+		entry := models.ComplianceReportEntry{Device: device, State: state}
+		if state.ViolatingSince != nil {
+			entry.ViolatingDuration = int64(now.Sub(*state.ViolatingSince).Seconds())
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ViolatingDuration > entries[j].ViolatingDuration
+	})
+	return entries, nil
+}
+
+// GetStates returns the current compliance states of all devices
+func GetStates(ctx context.Context, database *database.Database) (map[string]models.ComplianceState, error) {
+	states, err := getStates(ctx, database, "SELECT * FROM compliance_states")
+	if err != nil {
+		return nil, err
+	}
+	current := map[string]models.ComplianceState{}
+	for _, state := range states {
+		current[state.Id] = state
+	}
+	return current, nil
+}
+
+// GetHistory returns all compliance changes of the device, newest first
+func GetHistory(ctx context.Context, database *database.Database, id string) ([]models.ComplianceState, error) {
+	return getStates(ctx, database, "SELECT * FROM compliance_history WHERE id = ? ORDER BY timestamp DESC", id)
+}
+
+func getStates(ctx context.Context, database *database.Database, query string, args ...interface{}) ([]models.ComplianceState, error) {
+	rows, _err := database.DB.QueryContext(ctx, query, args...)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	states := []models.ComplianceState{}
+	for rows.Next() {
+		state := models.ComplianceState{}
+		var violatingSince, timestamp mysql.NullTime
+		err := rows.Scan(
+			&state.Id,
+			&state.ExecutedPolicyName,
+			&state.ExecutedPolicyVersion,
+			&state.ExecutedPolicyState,
+			&state.PolicyName,
+			&state.PolicyVersion,
+			&state.PolicyState,
+			&state.RulesetName,
+			&state.RulesetVersion,
+			&state.NoticeCount,
+			&state.ViolatedCount,
+			&violatingSince,
+			&timestamp,
+		)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		if violatingSince.Valid {
+			since := violatingSince.Time
+			state.ViolatingSince = &since
+		}
+		if timestamp.Valid {
+			state.Timestamp = timestamp.Time
+		}
+		states = append(states, state)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return states, nil
+}
@@ -0,0 +1,40 @@
+package compliance
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/export"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+func Serve(root *gin.RouterGroup, database *database.Database, getDevices func(context.Context, *database.Database) (*[]models.GeneralDevice, error)) {
+	root.GET("/compliance", func(c *gin.Context) {
+		devices, err := getDevices(c.Request.Context(), database)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		entries, err := GetViolatingDevices(c.Request.Context(), database, *devices)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if export.GetFormat(c) != "" {
+			export.Respond(c, "devices", entries)
+			return
+		}
+		c.JSON(200, gin.H{"total": len(*devices), "violating": len(entries), "devices": entries})
+	})
+
+	root.GET("/devices/:id/compliance/history", func(c *gin.Context) {
+		states, err := GetHistory(c.Request.Context(), database, c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "history", states)
+	})
+}
@@ -1,64 +1,205 @@
 package config
 
 import (
+	"io"
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
+
+	"github.com/viktoriaschule/management-server/models"
 )
 
-// Config contains the parsed contents of hover.yaml
+// Config contains the merged defaults, config file, environment variables and flags
 type Config struct {
-	loaded   bool
 	Relution struct {
-		Host  string
-		Token string
+		Host        string
+		Token       string
+		TokenFile   string `yaml:"token_file"`
+		SyncTimeout time.Duration
 	}
 	Mysql struct {
-		Host     string
-		Port     int
-		User     string
-		Password string
-		Name     string
+		Host         string
+		Port         int
+		User         string
+		Password     string
+		PasswordFile string `yaml:"password_file"`
+		Name         string
 	}
 	Ldap struct {
-		Url string
+		Url     string
+		UrlFile string `yaml:"url_file"`
+	}
+	History struct {
+		FullDays   int
+		HourlyDays int
+		DailyDays  int
+	}
+	Connection struct {
+		StaleAfter   time.Duration
+		MissingAfter time.Duration
+	}
+	Apps struct {
+		Required []struct {
+			Identifier string
+			MinVersion string
+		}
+	}
+	OsUpdate struct {
+		MinimumVersion string
+		StalledAfter   time.Duration
+	}
+	Storage struct {
+		MinFreePercent float64
+		MinFreeGb      float64
+		RetentionDays  int
+	}
+	Health struct {
+		MaxSyncAge time.Duration
+	}
+	Audit struct {
+		RetentionDays int
+	}
+	Naming struct {
+		TeacherPrefix  string
+		GroupSeparator string
+		IgnoredUsers   []string
+	}
+	Jobs map[string]struct {
+		Interval time.Duration
+		Cron     string
+		Jitter   time.Duration
+	}
+	Log struct {
+		Format   string
+		Output   string
+		Packages map[string]string
+	}
+	Tls struct {
+		Cert string
+		Key  string
+		// The port of a plain HTTP server that redirects to HTTPS, disabled if zero
+		RedirectPort int
+	}
+	Server struct {
+		ReadTimeout  time.Duration
+		WriteTimeout time.Duration
+		// Cancels the context of a request, except for exports, which are streamed as long as the client reads
+		RequestTimeout time.Duration
+		IdleTimeout    time.Duration
+		MaxHeaderBytes int
+		MaxBodyBytes   int64
+	}
+	Cors struct {
+		// Origins of browser clients (e.g. https://dashboard.example.com) or * for all, disabled if empty
+		AllowedOrigins   []string
+		AllowedMethods   []string
+		AllowedHeaders   []string
+		AllowCredentials bool
+		MaxAge           time.Duration
+	}
+	Admins          []string
+	Port            int
+	ShutdownTimeout time.Duration
+	LogLevel        string
+
+	// The secret files by the paths of their settings
+	secrets map[string]*secretFile
+}
+
+// Options select the sources of the config besides the defaults
+type Options struct {
+	// Path of the config file
+	Path string
+	// If the config file may be missing, which is only allowed for the default path
+	Optional bool
+	// Settings by their dotted path (e.g. mysql.password), which override all other sources
+	Overrides map[string]string
+}
+
+// The prefix of all environment variables, followed by the upper case setting path (e.g. MANAGEMENT_MYSQL_PASSWORD)
+const envPrefix = "MANAGEMENT_"
+
+// NamingRules returns the configured rules to parse device names
+func (c *Config) NamingRules() models.NamingRules {
+	return models.NamingRules{
+		TeacherPrefix:  c.Naming.TeacherPrefix,
+		GroupSeparator: c.Naming.GroupSeparator,
+		IgnoredUsers:   c.Naming.IgnoredUsers,
 	}
-	Port     int
-	LogLevel string
 }
 
-var config = Config{}
+// Returns the config with all values that are not required to be set
+func defaults() *Config {
+	config := &Config{}
+	config.Mysql.Port = 3306
+	config.Naming.TeacherPrefix = models.DefaultNamingRules.TeacherPrefix
+	config.Naming.GroupSeparator = models.DefaultNamingRules.GroupSeparator
+	config.Naming.IgnoredUsers = models.DefaultNamingRules.IgnoredUsers
+	config.Server.ReadTimeout = time.Second * 30
+	config.Server.RequestTimeout = time.Minute * 2
+	config.Server.IdleTimeout = time.Minute * 2
+	config.Server.MaxHeaderBytes = 1 << 16
+	config.Server.MaxBodyBytes = 1 << 20
+	config.Cors.AllowedMethods = []string{"GET", "POST", "PUT", "DELETE"}
+	config.Cors.AllowedHeaders = []string{"Authorization", "Content-Type"}
+	config.Cors.MaxAge = time.Minute * 10
+	config.Port = 9000
+	config.LogLevel = "debug"
+	return config
+}
 
-// GetConfig returns the working directory config.yaml as a Config
-func GetConfig() *Config {
-	if !config.loaded {
-		c, err := ReadConfigFile("config.yaml")
-		if err != nil {
-			return &config
+// Load merges the defaults, the config file, the environment variables and the overrides
+// in this order and validates the result. All problems are returned at once
+func Load(options Options) (*Config, error) {
+	config := defaults()
+
+	if err := readConfigFile(options.Path, config); err != nil {
+		if !(options.Optional && os.IsNotExist(errors.Cause(err))) {
+			return nil, err
 		}
-		config = *c
-		config.loaded = true
 	}
-	return &config
+
+	var problems []string
+	problems = append(problems, applyEnvironment(config)...)
+	problems = append(problems, applyOverrides(config, options.Overrides)...)
+	problems = append(problems, config.loadSecrets()...)
+	problems = append(problems, config.Validate()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return config, nil
 }
 
 // ReadConfigFile reads a .yaml file at a path and return a correspond
 // Config struct
 func ReadConfigFile(configPath string) (*Config, error) {
+	config := &Config{}
+	if err := readConfigFile(configPath, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Decodes the .yaml file at a path into the config, values missing in the file are kept
+func readConfigFile(configPath string, config *Config) error {
 	file, err := os.Open(configPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, errors.Wrap(err, "Warning: No hover.yaml file found")
+			return errors.Wrapf(err, "No config file %s found", configPath)
 		}
-		return nil, errors.Wrap(err, "Failed to open hover.yaml")
+		return errors.Wrapf(err, "Failed to open config file %s", configPath)
 	}
+	//noinspection GoUnhandledErrorResult
 	defer file.Close()
 
-	var config Config
-	err = yaml.NewDecoder(file).Decode(&config)
-	if err != nil {
-		return nil, errors.Wrap(err, "Failed to decode hover.yaml")
+	// Unknown or misspelled keys are errors instead of being ignored
+	decoder := yaml.NewDecoder(file)
+	decoder.SetStrict(true)
+	err = decoder.Decode(config)
+	if err != nil && err != io.EOF {
+		return errors.Wrapf(err, "Failed to decode config file %s", configPath)
 	}
-	return &config, nil
+	return nil
 }
@@ -0,0 +1,20 @@
+package config
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Serve(admin *gin.RouterGroup, reloader *Reloader) {
+	admin.POST("/config/reload", func(c *gin.Context) {
+		result, err := reloader.Reload()
+		if err != nil {
+			if validationError, ok := err.(*ValidationError); ok {
+				c.JSON(400, gin.H{"error": "Invalid config", "problems": validationError.Problems})
+				return
+			}
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, result)
+	})
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The settings that are only applied on start, all other settings are applied on reload
+var restartSettings = map[string]bool{
+	"mysql.host":            true,
+	"mysql.port":            true,
+	"mysql.user":            true,
+	"mysql.name":            true,
+	"mysql.password":        true,
+	"mysql.password_file":   true,
+	"relution.token_file":   true,
+	"ldap.url_file":         true,
+	"tls.cert":              true,
+	"tls.key":               true,
+	"tls.redirectport":      true,
+	"server.readtimeout":    true,
+	"server.writetimeout":   true,
+	"server.idletimeout":    true,
+	"server.maxheaderbytes": true,
+	"port":                  true,
+}
+
+// ReloadResult lists the changed settings of a reload
+type ReloadResult struct {
+	Applied         []string `json:"applied"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// Reloader rereads the config from its sources and publishes it as a new config,
+// a published config is never modified, so readers take a consistent snapshot with Config
+type Reloader struct {
+	mutex   sync.Mutex
+	current atomic.Value
+	options Options
+	hooks   []func(config *Config)
+}
+
+func NewReloader(config *Config, options Options) *Reloader {
+	reloader := &Reloader{options: options}
+	reloader.current.Store(config)
+	return reloader
+}
+
+// Config returns the current config, which must not be modified
+func (r *Reloader) Config() *Config {
+	return r.current.Load().(*Config)
+}
+
+// OnReload registers a hook that applies the reloaded config, e.g. to the logger
+func (r *Reloader) OnReload(hook func(config *Config)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.hooks = append(r.hooks, hook)
+}
+
+// Reload loads and validates the config and applies all changed settings that do not require a restart.
+// If the config is invalid, nothing is applied
+func (r *Reloader) Reload() (*ReloadResult, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	next, err := Load(r.options)
+	if err != nil {
+		return nil, err
+	}
+	current := r.Config()
+	result := &ReloadResult{Applied: []string{}, RestartRequired: []string{}}
+	// A secret and its file are one setting, because switching to or from a file requires a restart
+	nextSecrets := next.secretSettings()
+	for i, secret := range current.secretSettings() {
+		if *secret.file != *nextSecrets[i].file {
+			result.RestartRequired = append(result.RestartRequired, secret.path, secret.path+"_file")
+			*nextSecrets[i].value = *secret.value
+			*nextSecrets[i].file = *secret.file
+		}
+	}
+	keepRestartSettings(reflect.ValueOf(current).Elem(), reflect.ValueOf(next).Elem(), nil, result)
+	// The secret files are only opened on start and reread on change
+	next.secrets = current.secrets
+	sort.Strings(result.Applied)
+	sort.Strings(result.RestartRequired)
+
+	r.current.Store(next)
+	for _, hook := range r.hooks {
+		hook(next)
+	}
+	return result, nil
+}
+
+// Lists all changed settings and keeps the current value of the ones that require a restart in next
+func keepRestartSettings(current reflect.Value, next reflect.Value, path []string, result *ReloadResult) {
+	for i := 0; i < current.NumField(); i++ {
+		field := current.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.ToLower(field.Name)
+		if tag := field.Tag.Get("yaml"); tag != "" {
+			name = strings.Split(tag, ",")[0]
+		}
+		fieldPath := append(append([]string{}, path...), name)
+		if field.Type.Kind() == reflect.Struct {
+			keepRestartSettings(current.Field(i), next.Field(i), fieldPath, result)
+			continue
+		}
+		if reflect.DeepEqual(current.Field(i).Interface(), next.Field(i).Interface()) {
+			continue
+		}
+		key := strings.Join(fieldPath, ".")
+		if restartSettings[key] {
+			result.RestartRequired = append(result.RestartRequired, key)
+			next.Field(i).Set(current.Field(i))
+			continue
+		}
+		result.Applied = append(result.Applied, key)
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/viktoriaschule/management-server/log"
+)
+
+// How often secret files are checked for changes
+const secretCheckInterval = time.Second * 10
+
+// An empty file is most likely not mounted or written yet and would silently disable the secret
+var errEmptySecret = errors.New("empty")
+
+// A secret that is read from a file, like mounted docker or kubernetes secrets,
+// and reread when the file changed
+type secretFile struct {
+	path    string
+	mutex   sync.Mutex
+	value   string
+	modTime time.Time
+	size    int64
+	checked time.Time
+}
+
+func newSecretFile(path string) (*secretFile, error) {
+	secret := &secretFile{path: path}
+	if err := secret.read(); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// Reads the file, a trailing line break is not part of the secret and an empty secret is an error
+func (s *secretFile) read() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(content)) == "" {
+		return errEmptySecret
+	}
+	s.value = strings.TrimRight(string(content), "\r\n")
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	s.checked = time.Now()
+	return nil
+}
+
+// Returns the current secret, if the file cannot be read, the last secret is kept
+func (s *secretFile) get() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if time.Since(s.checked) < secretCheckInterval {
+		return s.value
+	}
+	s.checked = time.Now()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		log.Warnf("Cannot check secret file %s: %v", s.path, err)
+		return s.value
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return s.value
+	}
+	if err = s.read(); err != nil {
+		log.Warnf("Cannot reload secret file %s: %v", s.path, err)
+		return s.value
+	}
+	log.Infof("Reloaded secret file %s", s.path)
+	return s.value
+}
+
+// A secret that is either set directly or read from the file of the setting with the _file suffix
+type secretSetting struct {
+	path  string
+	value *string
+	file  *string
+}
+
+// Returns the secret settings of the config
+func (c *Config) secretSettings() []secretSetting {
+	return []secretSetting{
+		{"relution.token", &c.Relution.Token, &c.Relution.TokenFile},
+		{"mysql.password", &c.Mysql.Password, &c.Mysql.PasswordFile},
+		{"ldap.url", &c.Ldap.Url, &c.Ldap.UrlFile},
+	}
+}
+
+// Opens the configured secret files, a secret can either be set directly or as file
+func (c *Config) loadSecrets() []string {
+	var problems []string
+	c.secrets = map[string]*secretFile{}
+	for _, f := range c.secretSettings() {
+		if *f.file == "" {
+			continue
+		}
+		if *f.value != "" {
+			problems = append(problems, f.path+": cannot be combined with "+f.path+"_file")
+			continue
+		}
+		secret, err := newSecretFile(*f.file)
+		if err != nil {
+			problems = append(problems, f.path+"_file: "+err.Error())
+			continue
+		}
+		c.secrets[f.path] = secret
+	}
+	return problems
+}
+
+// Returns the secret of the file configured for the path, or the given value
+func (c *Config) secret(path string, value string) string {
+	if secret, ok := c.secrets[path]; ok {
+		return secret.get()
+	}
+	return value
+}
+
+// RelutionToken returns the relution token, read from the token file if configured
+func (c *Config) RelutionToken() string {
+	return c.secret("relution.token", c.Relution.Token)
+}
+
+// MysqlPassword returns the mysql password, read from the password file if configured
+func (c *Config) MysqlPassword() string {
+	return c.secret("mysql.password", c.Mysql.Password)
+}
+
+// LdapUrl returns the ldap url, read from the url file if configured
+func (c *Config) LdapUrl() string {
+	return c.secret("ldap.url", c.Ldap.Url)
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Calls the handler for every setting, the path contains the lower case field names like the keys in the config file.
+// Only the settings of a settable type can be set from a single string, the others only in the config file
+func walkSettings(value reflect.Value, path []string, handler func(path []string, field reflect.Value)) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.ToLower(field.Name)
+		if tag := field.Tag.Get("yaml"); tag != "" {
+			name = strings.Split(tag, ",")[0]
+		}
+		fieldPath := append(append([]string{}, path...), name)
+		fieldValue := value.Field(i)
+		if fieldValue.Kind() == reflect.Struct {
+			walkSettings(fieldValue, fieldPath, handler)
+			continue
+		}
+		handler(fieldPath, fieldValue)
+	}
+}
+
+func isSettable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Int, reflect.Int64, reflect.Float64, reflect.Bool:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// Parses the string as the type of the field and sets it, lists are comma separated
+func setSetting(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(number)
+	case reflect.Float64:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(number)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	}
+	return nil
+}
+
+// Sets all settings with a matching environment variable
+func applyEnvironment(config *Config) []string {
+	var problems []string
+	walkSettings(reflect.ValueOf(config).Elem(), nil, func(path []string, field reflect.Value) {
+		name := envPrefix + strings.ToUpper(strings.Join(path, "_"))
+		if !isSettable(field.Type()) {
+			for _, variable := range os.Environ() {
+				if key := strings.SplitN(variable, "=", 2)[0]; key == name || strings.HasPrefix(key, name+"_") {
+					problems = append(problems, fmt.Sprintf("%s: can only be set in the config file", key))
+				}
+			}
+			return
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if err := setSetting(field, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	})
+	return problems
+}
+
+// Sets the settings by their dotted paths
+func applyOverrides(config *Config, overrides map[string]string) []string {
+	var problems []string
+	remaining := map[string]string{}
+	for key, value := range overrides {
+		remaining[strings.ToLower(key)] = value
+	}
+	var fileOnly []string
+	walkSettings(reflect.ValueOf(config).Elem(), nil, func(path []string, field reflect.Value) {
+		key := strings.Join(path, ".")
+		if !isSettable(field.Type()) {
+			fileOnly = append(fileOnly, key)
+			return
+		}
+		value, ok := remaining[key]
+		if !ok {
+			return
+		}
+		delete(remaining, key)
+		if err := setSetting(field, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+		}
+	})
+	for key := range remaining {
+		problem := "unknown setting"
+		for _, path := range fileOnly {
+			if key == path || strings.HasPrefix(key, path+".") {
+				problem = "can only be set in the config file"
+			}
+		}
+		problems = append(problems, fmt.Sprintf("%s: %s", key, problem))
+	}
+	return problems
+}
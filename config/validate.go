@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/schedule"
+)
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+var logFormats = []string{"", "console", "json"}
+
+// ValidationError contains all problems of an invalid config
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate returns all missing and invalid settings
+func (c *Config) Validate() []string {
+	var problems []string
+	require := func(path string, value string) {
+		if value == "" {
+			problems = append(problems, fmt.Sprintf("%s: missing", path))
+		}
+	}
+	check := func(path string, valid bool, message string) {
+		if !valid {
+			problems = append(problems, fmt.Sprintf("%s: %s", path, message))
+		}
+	}
+
+	require("relution.host", c.Relution.Host)
+	// Problems of secret files are reported when they are loaded
+	if c.Relution.TokenFile == "" {
+		require("relution.token", c.Relution.Token)
+	}
+	check("relution.synctimeout", c.Relution.SyncTimeout >= 0, "must not be negative")
+	require("mysql.host", c.Mysql.Host)
+	require("mysql.user", c.Mysql.User)
+	require("mysql.name", c.Mysql.Name)
+	check("mysql.port", c.Mysql.Port > 0 && c.Mysql.Port <= 65535, "must be a port between 1 and 65535")
+	if c.Ldap.UrlFile == "" {
+		require("ldap.url", c.Ldap.Url)
+	}
+
+	check("history.fulldays", c.History.FullDays >= 0, "must not be negative")
+	check("history.hourlydays", c.History.HourlyDays >= 0, "must not be negative")
+	check("history.dailydays", c.History.DailyDays >= 0, "must not be negative")
+	check("connection.staleafter", c.Connection.StaleAfter >= 0, "must not be negative")
+	check("connection.missingafter", c.Connection.MissingAfter >= 0, "must not be negative")
+	for i, app := range c.Apps.Required {
+		require(fmt.Sprintf("apps.required[%d].identifier", i), app.Identifier)
+	}
+	if c.OsUpdate.MinimumVersion != "" {
+		_, err := helper.ParseVersion(c.OsUpdate.MinimumVersion)
+		check("osupdate.minimumversion", err == nil, "must be a dotted numeric version like 13.4.1")
+	}
+	check("osupdate.stalledafter", c.OsUpdate.StalledAfter >= 0, "must not be negative")
+	check("storage.minfreepercent", c.Storage.MinFreePercent >= 0 && c.Storage.MinFreePercent <= 100, "must be between 0 and 100")
+	check("storage.minfreegb", c.Storage.MinFreeGb >= 0, "must not be negative")
+	check("storage.retentiondays", c.Storage.RetentionDays >= 0, "must not be negative")
+	check("health.maxsyncage", c.Health.MaxSyncAge >= 0, "must not be negative")
+	check("audit.retentiondays", c.Audit.RetentionDays >= 0, "must not be negative")
+
+	require("naming.teacherprefix", c.Naming.TeacherPrefix)
+	require("naming.groupseparator", c.Naming.GroupSeparator)
+
+	for name, job := range c.Jobs {
+		if _, err := schedule.Parse(job.Interval, job.Cron, 0); err != nil {
+			problems = append(problems, fmt.Sprintf("jobs.%s: %v", name, err))
+		}
+		check(fmt.Sprintf("jobs.%s.jitter", name), job.Jitter >= 0, "must not be negative")
+	}
+
+	check("tls.cert", c.Tls.Key == "" || c.Tls.Cert != "", "required with tls.key")
+	check("tls.key", c.Tls.Cert == "" || c.Tls.Key != "", "required with tls.cert")
+	check("tls.redirectport", c.Tls.RedirectPort >= 0 && c.Tls.RedirectPort <= 65535, "must be a port between 1 and 65535")
+	check("tls.redirectport", c.Tls.RedirectPort == 0 || c.Tls.Cert != "", "requires tls.cert and tls.key")
+	check("tls.redirectport", c.Tls.RedirectPort == 0 || c.Tls.RedirectPort != c.Port, "must differ from port")
+	check("server.readtimeout", c.Server.ReadTimeout >= 0, "must not be negative")
+	check("server.writetimeout", c.Server.WriteTimeout >= 0, "must not be negative")
+	check("server.requesttimeout", c.Server.RequestTimeout >= 0, "must not be negative")
+	check("server.idletimeout", c.Server.IdleTimeout >= 0, "must not be negative")
+	check("server.maxheaderbytes", c.Server.MaxHeaderBytes >= 0, "must not be negative")
+	check("server.maxbodybytes", c.Server.MaxBodyBytes >= 0, "must not be negative")
+	for i, origin := range c.Cors.AllowedOrigins {
+		valid := origin == "*" || strings.HasPrefix(origin, "http://") || strings.HasPrefix(origin, "https://")
+		check(fmt.Sprintf("cors.allowedorigins[%d]", i), valid, "must be * or an origin like https://example.com")
+	}
+	check("cors.allowcredentials", !c.Cors.AllowCredentials || !contains(c.Cors.AllowedOrigins, "*"),
+		"cannot be combined with the origin *")
+	check("cors.maxage", c.Cors.MaxAge >= 0, "must not be negative")
+
+	check("log.format", contains(logFormats, c.Log.Format), "must be console or json")
+	for name, level := range c.Log.Packages {
+		check("log.packages."+name, contains(logLevels, level), "must be one of "+strings.Join(logLevels, ", "))
+	}
+	check("loglevel", contains(logLevels, c.LogLevel), "must be one of "+strings.Join(logLevels, ", "))
+	check("port", c.Port > 0 && c.Port <= 65535, "must be a port between 1 and 65535")
+	check("shutdowntimeout", c.ShutdownTimeout >= 0, "must not be negative")
+	return problems
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
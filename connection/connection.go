@@ -0,0 +1,238 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+// The stored connection states of all devices
+var oldConnections map[string]models.DeviceConnection
+
+// The lost mode and location information of all synced devices
+var syncedConnections map[string]models.DeviceConnection
+
+// Prepares the device connection synchronization
+func StartSync(ctx context.Context, database *database.Database) {
+	syncedConnections = map[string]models.DeviceConnection{}
+
+	var err error
+	oldConnections, err = GetConnections(ctx, database)
+	if err != nil {
+		log.Warnf("Error during fetching old connection states: %v", err)
+		oldConnections = map[string]models.DeviceConnection{}
+	}
+}
+
+// Stores the lost mode and location information of the device
+func SyncDevice(device *models.GeneralDevice, rDevice *models.RelutionDevice) {
+	syncedConnections[device.Id] = models.DeviceConnection{
+		Id:       device.Id,
+		LostMode: rDevice.Details.IsMDMLostModeEnabled,
+		Location: models.RelutionDeviceToDeviceLocation(*rDevice),
+	}
+}
+
+// Classifies all devices by their last connection,
+// stores the changed states and records all state transitions
+func EndSync(ctx context.Context, database *database.Database, config *config.Config, devices []models.GeneralDevice) error {
+	var lastErr error
+	failed := 0
+	now := time.Now()
+	for _, device := range devices {
+		connection, isSynced := syncedConnections[device.Id]
+		oldConnection, isOld := oldConnections[device.Id]
+		if !isSynced {
+			// Keep the last known information of devices relution does not return anymore
+			connection = oldConnection
+			connection.Id = device.Id
+		}
+		connection.State = GetState(config, device.LastConnection, now)
+		connection.Since = oldConnection.Since
+
+		if !isOld || oldConnection.State != connection.State {
+			connection.Since = now
+			if err := addTransition(ctx, database, device.Id, oldConnection.State, connection.State, now); err != nil {
+				lastErr = err
+				failed++
+			}
+		} else if oldConnection.LostMode == connection.LostMode && locationsAreEqual(oldConnection.Location, connection.Location) {
+			continue
+		}
+		if err := setConnection(ctx, database, &connection); err != nil {
+			lastErr = err
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("error updating %d connection states or transitions: %v", failed, lastErr)
+	}
+	return nil
+}
+
+// GetState returns the connection state for the last connection of a device
+func GetState(config *config.Config, lastConnection time.Time, now time.Time) string {
+	staleAfter := config.Connection.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = defaultStaleAfter
+	}
+	missingAfter := config.Connection.MissingAfter
+	if missingAfter <= 0 {
+		missingAfter = defaultMissingAfter
+	}
+
+	offline := now.Sub(lastConnection)
+	if offline >= missingAfter {
+		return Missing
+	} else if offline >= staleAfter {
+		return Stale
+	}
+	return Online
+}
+
+// GetMissingDevices returns all missing devices (and stale devices if requested)
+// with their connection state, lost mode and last known location
+func GetMissingDevices(ctx context.Context, database *database.Database, devices []models.GeneralDevice, includeStale bool) ([]models.MissingDevice, error) {
+	connections, err := GetConnections(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	missingDevices := []models.MissingDevice{}
+	for _, device := range devices {
+		connection, exists := connections[device.Id]
+		if !exists {
+			continue
+		}
+		if connection.State == Missing || (includeStale && connection.State == Stale) {
+			missingDevices = append(missingDevices, models.MissingDevice{GeneralDevice: device, Connection: connection})
+		}
+	}
+	return missingDevices, nil
+}
+
+// GetConnections returns the stored connection states of all devices
+func GetConnections(ctx context.Context, database *database.Database) (map[string]models.DeviceConnection, error) {
+	rows, _err := database.DB.QueryContext(ctx, "SELECT * FROM device_connections")
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	connections := map[string]models.DeviceConnection{}
+	for rows.Next() {
+		connection := models.DeviceConnection{}
+		var since, locationTime mysql.NullTime
+		var latitude, longitude, accuracy sql.NullFloat64
+		err := rows.Scan(&connection.Id, &connection.State, &since, &connection.LostMode, &latitude, &longitude, &accuracy, &locationTime)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		if since.Valid {
+			connection.Since = since.Time
+		}
+		if locationTime.Valid {
+			connection.Location = &models.DeviceLocation{
+				Latitude:  latitude.Float64,
+				Longitude: longitude.Float64,
+				Accuracy:  accuracy.Float64,
+				Time:      locationTime.Time,
+			}
+		}
+		connections[connection.Id] = connection
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return connections, nil
+}
+
+// Adds or updates the connection state of a device
+func setConnection(ctx context.Context, database *database.Database, connection *models.DeviceConnection) error {
+	var latitude, longitude, accuracy, locationTime interface{}
+	if connection.Location != nil {
+		latitude = connection.Location.Latitude
+		longitude = connection.Location.Longitude
+		accuracy = connection.Location.Accuracy
+		locationTime = connection.Location.Time.UTC().Format(helper.SqlDateFormat)
+	}
+	since := connection.Since.UTC().Format(helper.SqlDateFormat)
+	_, err := database.DB.ExecContext(ctx,
+		"INSERT INTO device_connections VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE state = ?, since = ?, lost_mode = ?, latitude = ?, longitude = ?, location_accuracy = ?, location_time = ?",
+		connection.Id, connection.State, since, connection.LostMode, latitude, longitude, accuracy, locationTime,
+		connection.State, since, connection.LostMode, latitude, longitude, accuracy, locationTime,
+	)
+	if err != nil {
+		log.Warnf("Error setting connection state: %v", err)
+	}
+	return err
+}
+
+// Records the change of the connection state of a device
+func addTransition(ctx context.Context, database *database.Database, id string, previousState string, state string, timestamp time.Time) error {
+	if previousState != "" {
+		log.Infof("Device %s changed from %s to %s", id, previousState, state)
+	}
+	_, err := database.DB.ExecContext(ctx,
+		"INSERT INTO connection_history VALUES (?, ?, ?, ?)",
+		id,
+		previousState,
+		state,
+		timestamp.UTC().Format(helper.SqlDateFormat),
+	)
+	if err != nil {
+		log.Warnf("Error adding connection transition: %v", err)
+	}
+	return err
+}
+
+// GetTransitions returns all connection state changes of the device, newest first
+func GetTransitions(ctx context.Context, database *database.Database, id string) ([]models.ConnectionTransition, error) {
+	rows, _err := database.DB.QueryContext(ctx, "SELECT * FROM connection_history WHERE id = ? ORDER BY timestamp DESC", id)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	transitions := []models.ConnectionTransition{}
+	for rows.Next() {
+		transition := models.ConnectionTransition{}
+		var timestamp mysql.NullTime
+		err := rows.Scan(&transition.Id, &transition.PreviousState, &transition.State, &timestamp)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		if timestamp.Valid {
+			transition.Timestamp = timestamp.Time
+		}
+		transitions = append(transitions, transition)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return transitions, nil
+}
+
+func locationsAreEqual(l1 *models.DeviceLocation, l2 *models.DeviceLocation) bool {
+	if l1 == nil || l2 == nil {
+		return l1 == l2
+	}
+	return l1.Latitude == l2.Latitude && l1.Longitude == l2.Longitude && l1.Accuracy == l2.Accuracy && models.CompareTimes(l1.Time, l2.Time)
+}
@@ -0,0 +1,41 @@
+package connection
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/export"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+func Serve(root *gin.RouterGroup, database *database.Database, getDevices func(context.Context, *database.Database) (*[]models.GeneralDevice, error)) {
+	root.GET("/missing-devices", func(c *gin.Context) {
+		request := MissingRequest{}
+		if err := c.ShouldBindQuery(&request); err != nil {
+			c.JSON(400, gin.H{"error": "Wrong query format"})
+			return
+		}
+		devices, err := getDevices(c.Request.Context(), database)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		missingDevices, err := GetMissingDevices(c.Request.Context(), database, *devices, request.IncludeStale)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "devices", missingDevices)
+	})
+
+	root.GET("/devices/:id/connections", func(c *gin.Context) {
+		transitions, err := GetTransitions(c.Request.Context(), database, c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "transitions", transitions)
+	})
+}
@@ -0,0 +1,20 @@
+package connection
+
+import "time"
+
+// The connection states of a device
+const (
+	Online  = "online"
+	Stale   = "stale"
+	Missing = "missing"
+)
+
+// The default duration without connection after a device is stale (1h)
+const defaultStaleAfter = time.Hour
+
+// The default duration without connection after a device is missing (7d)
+const defaultMissingAfter = time.Hour * 24 * 7
+
+type MissingRequest struct {
+	IncludeStale bool `form:"include_stale"`
+}
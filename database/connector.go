@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/viktoriaschule/management-server/config"
+)
+
+// Opens every connection with the current credentials, so a changed password file
+// is used for new connections without a restart
+type connector struct {
+	config *config.Config
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	mysqlConfig := mysql.NewConfig()
+	mysqlConfig.User = c.config.Mysql.User
+	mysqlConfig.Passwd = c.config.MysqlPassword()
+	mysqlConfig.Net = "tcp"
+	mysqlConfig.Addr = fmt.Sprintf("%s:%d", c.config.Mysql.Host, c.config.Mysql.Port)
+	mysqlConfig.DBName = c.config.Mysql.Name
+
+	mysqlConnector, err := mysql.NewConnector(mysqlConfig)
+	if err != nil {
+		return nil, err
+	}
+	return mysqlConnector.Connect(ctx)
+}
+
+func (c *connector) Driver() driver.Driver {
+	return mysql.MySQLDriver{}
+}
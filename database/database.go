@@ -1,13 +1,11 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"os"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
-
 	"github.com/viktoriaschule/management-server/config"
 	"github.com/viktoriaschule/management-server/log"
 )
@@ -17,18 +15,7 @@ type Database struct {
 }
 
 func NewDatabase(config *config.Config) *Database {
-	db, err := sql.Open("mysql",
-		fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
-			config.Mysql.User,
-			config.Mysql.Password,
-			config.Mysql.Host,
-			config.Mysql.Port,
-			config.Mysql.Name,
-		))
-	if err != nil {
-		log.Errorf("Error connecting to database: %v", err)
-		os.Exit(1)
-	}
+	db := sql.OpenDB(&connector{config: config})
 	db.SetMaxOpenConns(5)
 	db.SetMaxIdleConns(5)
 	db.SetConnMaxLifetime(time.Hour)
@@ -39,8 +26,29 @@ func NewDatabase(config *config.Config) *Database {
 
 func (d Database) CreateTables() {
 	statements := []string{
+		"CREATE TABLE IF NOT EXISTS settings (name VARCHAR(64) NOT NULL, value TEXT NOT NULL, PRIMARY KEY (name))",
 		"CREATE TABLE IF NOT EXISTS devices (id VARCHAR(12) NOT NULL, name TEXT NOT NULL, loggedin_user TEXT NOT NULL, device_type BOOLEAN NOT NULL, battery_level FLOAT NOT NULL, is_charging BOOLEAN, device_group INT NOT NULL, device_group_index VARCHAR(1) NOT NULL, last_modified DATETIME, last_connection DATETIME NOT NULL, status TEXT NOT NULL, PRIMARY KEY (id))",
 		"CREATE TABLE IF NOT EXISTS history (id VARCHAR(12) NOT NULL, level FLOAT NOT NULL, loggedin_user TEXT NOT NULL, status TEXT NOT NULL, modified DATETIME NOT NULL, timestamp DATETIME NOT NULL, PRIMARY KEY (id, modified))",
+		"CREATE TABLE IF NOT EXISTS history_hourly (id VARCHAR(12) NOT NULL, period DATETIME NOT NULL, level FLOAT NOT NULL, min_level INT NOT NULL, max_level INT NOT NULL, loggedin_user TEXT NOT NULL, status TEXT NOT NULL, samples INT NOT NULL, PRIMARY KEY (id, period))",
+		"CREATE TABLE IF NOT EXISTS history_daily (id VARCHAR(12) NOT NULL, period DATETIME NOT NULL, level FLOAT NOT NULL, min_level INT NOT NULL, max_level INT NOT NULL, loggedin_user TEXT NOT NULL, status TEXT NOT NULL, samples INT NOT NULL, PRIMARY KEY (id, period))",
+		"CREATE TABLE IF NOT EXISTS device_changes (id VARCHAR(12) NOT NULL, field VARCHAR(64) NOT NULL, old_value TEXT NOT NULL, new_value TEXT NOT NULL, timestamp DATETIME NOT NULL, INDEX (id, timestamp))",
+		"CREATE TABLE IF NOT EXISTS device_snapshots (id VARCHAR(12) NOT NULL, snapshot TEXT NOT NULL, PRIMARY KEY (id))",
+		"CREATE TABLE IF NOT EXISTS usage_daily (day DATE NOT NULL, scope VARCHAR(16) NOT NULL, scope_key VARCHAR(255) NOT NULL, logged_in_seconds BIGINT NOT NULL, battery_consumed BIGINT NOT NULL, sessions INT NOT NULL, PRIMARY KEY (day, scope, scope_key))",
+		"CREATE TABLE IF NOT EXISTS audit_log (id BIGINT NOT NULL AUTO_INCREMENT, timestamp DATETIME NOT NULL, username VARCHAR(255) NOT NULL, type VARCHAR(16) NOT NULL, method VARCHAR(16) NOT NULL, route TEXT NOT NULL, params TEXT NOT NULL, status INT NOT NULL, duration BIGINT NOT NULL, PRIMARY KEY (id), INDEX (timestamp), INDEX (username))",
+		"CREATE TABLE IF NOT EXISTS lendings (id BIGINT NOT NULL AUTO_INCREMENT, device_id VARCHAR(12) NOT NULL, borrower VARCHAR(255) NOT NULL, borrower_type VARCHAR(16) NOT NULL, issued_by VARCHAR(255) NOT NULL, checked_out DATETIME NOT NULL, due DATETIME, checked_in DATETIME, returned_to VARCHAR(255), note TEXT NOT NULL, open_device_id VARCHAR(12) AS (IF(checked_in IS NULL, device_id, NULL)) STORED, PRIMARY KEY (id), INDEX (device_id), INDEX (borrower), UNIQUE KEY (open_device_id))",
+		"CREATE TABLE IF NOT EXISTS device_groups (id INT NOT NULL, name TEXT NOT NULL, location TEXT NOT NULL, responsible_teacher TEXT NOT NULL, expected_devices INT NOT NULL, PRIMARY KEY (id))",
+		"CREATE TABLE IF NOT EXISTS device_connections (id VARCHAR(12) NOT NULL, state VARCHAR(16) NOT NULL, since DATETIME NOT NULL, lost_mode BOOLEAN NOT NULL, latitude DOUBLE, longitude DOUBLE, location_accuracy DOUBLE, location_time DATETIME, PRIMARY KEY (id))",
+		"CREATE TABLE IF NOT EXISTS device_details (id VARCHAR(12) NOT NULL, platform TEXT NOT NULL, manufacturer TEXT NOT NULL, model TEXT NOT NULL, model_name TEXT NOT NULL, product_name TEXT NOT NULL, serial_number TEXT NOT NULL, os_version TEXT NOT NULL, build_version TEXT NOT NULL, device_capacity DOUBLE NOT NULL, available_device_capacity DOUBLE NOT NULL, is_supervised BOOLEAN NOT NULL, is_activation_lock_enabled BOOLEAN NOT NULL, is_device_locator_service_enabled BOOLEAN NOT NULL, is_cloud_backup_enabled BOOLEAN NOT NULL, jailbroken BOOLEAN NOT NULL, enrollment_date DATETIME, timestamp DATETIME NOT NULL, PRIMARY KEY (id))",
+		"CREATE TABLE IF NOT EXISTS device_apps (id VARCHAR(12) NOT NULL, identifier VARCHAR(255) NOT NULL, name TEXT NOT NULL, version TEXT NOT NULL, short_version TEXT NOT NULL, managed BOOLEAN NOT NULL, has_update_available BOOLEAN NOT NULL, bundle_size BIGINT NOT NULL, dynamic_size BIGINT NOT NULL, PRIMARY KEY (id, identifier))",
+		"CREATE TABLE IF NOT EXISTS device_profiles (id VARCHAR(12) NOT NULL, uuid VARCHAR(64) NOT NULL, name TEXT NOT NULL, identifier TEXT NOT NULL, PRIMARY KEY (id, uuid))",
+		"CREATE TABLE IF NOT EXISTS app_changes (id VARCHAR(12) NOT NULL, identifier VARCHAR(255) NOT NULL, name TEXT NOT NULL, change_type VARCHAR(16) NOT NULL, old_version TEXT NOT NULL, new_version TEXT NOT NULL, timestamp DATETIME NOT NULL, INDEX (id, timestamp))",
+		"CREATE TABLE IF NOT EXISTS os_history (id VARCHAR(12) NOT NULL, os_version VARCHAR(32) NOT NULL, build_version VARCHAR(32) NOT NULL, timestamp DATETIME NOT NULL, PRIMARY KEY (id, timestamp))",
+		"CREATE TABLE IF NOT EXISTS os_updates (id VARCHAR(12) NOT NULL, product_key TEXT NOT NULL, update_status TEXT NOT NULL, download_percent DOUBLE NOT NULL, downloaded BOOLEAN NOT NULL, error_count INT NOT NULL, available_updates INT NOT NULL, last_status_time DATETIME, last_progress DATETIME NOT NULL, PRIMARY KEY (id))",
+		"CREATE TABLE IF NOT EXISTS storage_history (id VARCHAR(12) NOT NULL, capacity DOUBLE NOT NULL, available DOUBLE NOT NULL, timestamp DATETIME NOT NULL, PRIMARY KEY (id, timestamp))",
+		"CREATE TABLE IF NOT EXISTS compliance_states (id VARCHAR(12) NOT NULL, executed_policy_name TEXT NOT NULL, executed_policy_version INT NOT NULL, executed_policy_state TEXT NOT NULL, policy_name TEXT NOT NULL, policy_version INT NOT NULL, policy_state TEXT NOT NULL, ruleset_name TEXT NOT NULL, ruleset_version INT NOT NULL, notice_count INT NOT NULL, violated_count INT NOT NULL, violating_since DATETIME, timestamp DATETIME NOT NULL, PRIMARY KEY (id))",
+		"CREATE TABLE IF NOT EXISTS compliance_history (id VARCHAR(12) NOT NULL, executed_policy_name TEXT NOT NULL, executed_policy_version INT NOT NULL, executed_policy_state TEXT NOT NULL, policy_name TEXT NOT NULL, policy_version INT NOT NULL, policy_state TEXT NOT NULL, ruleset_name TEXT NOT NULL, ruleset_version INT NOT NULL, notice_count INT NOT NULL, violated_count INT NOT NULL, violating_since DATETIME, timestamp DATETIME NOT NULL, PRIMARY KEY (id, timestamp))",
+		"CREATE TABLE IF NOT EXISTS connection_history (id VARCHAR(12) NOT NULL, previous_state VARCHAR(16) NOT NULL, state VARCHAR(16) NOT NULL, timestamp DATETIME NOT NULL, PRIMARY KEY (id, timestamp))",
+		"CREATE TABLE IF NOT EXISTS sync_runs (id BIGINT NOT NULL AUTO_INCREMENT, start DATETIME NOT NULL, end DATETIME NOT NULL, devices_seen INT NOT NULL, devices_changed INT NOT NULL, history_entries INT NOT NULL, errors TEXT NOT NULL, PRIMARY KEY (id), INDEX (start))",
 	}
 	for _, statement := range statements {
 		_, err := d.DB.Exec(statement)
@@ -50,3 +58,27 @@ func (d Database) CreateTables() {
 		}
 	}
 }
+
+// GetSetting returns the stored value of a setting and if it is set
+func (d Database) GetSetting(ctx context.Context, name string) (string, bool, error) {
+	var value string
+	err := d.DB.QueryRowContext(ctx, "SELECT value FROM settings WHERE name = ?", name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// SetSetting stores the value of a setting
+func (d Database) SetSetting(ctx context.Context, name string, value string) error {
+	_, err := d.DB.ExecContext(ctx, "INSERT INTO settings VALUES (?, ?) ON DUPLICATE KEY UPDATE value = ?", name, value, value)
+	return err
+}
+
+// RemoveSetting removes the stored value of a setting
+func (d Database) RemoveSetting(ctx context.Context, name string) error {
+	_, err := d.DB.ExecContext(ctx, "DELETE FROM settings WHERE name = ?", name)
+	return err
+}
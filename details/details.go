@@ -0,0 +1,339 @@
+package details
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+// The stored details, apps and profiles of all devices
+var oldDetails map[string]models.DeviceDetails
+var oldApps map[string][]models.InstalledApp
+var oldProfiles map[string][]models.DeviceProfile
+
+// The changed details, apps and profiles of the current sync
+var changedDetails []models.DeviceDetails
+var changedApps map[string][]models.InstalledApp
+var changedProfiles map[string][]models.DeviceProfile
+
+// Prepares the device details synchronization
+func StartSync(ctx context.Context, database *database.Database) {
+	changedDetails = []models.DeviceDetails{}
+	changedApps = map[string][]models.InstalledApp{}
+	changedProfiles = map[string][]models.DeviceProfile{}
+
+	var err error
+	oldDetails, err = getDetails(ctx, database, "")
+	if err != nil {
+		log.Warnf("Error during fetching old device details: %v", err)
+		oldDetails = map[string]models.DeviceDetails{}
+	}
+	oldApps, err = GetInstalledApps(ctx, database)
+	if err != nil {
+		log.Warnf("Error during fetching old installed apps: %v", err)
+		oldApps = map[string][]models.InstalledApp{}
+	}
+	oldProfiles, err = getProfiles(ctx, database, "")
+	if err != nil {
+		log.Warnf("Error during fetching old device profiles: %v", err)
+		oldProfiles = map[string][]models.DeviceProfile{}
+	}
+}
+
+// Compares the details, apps and profiles of the device with the stored ones
+// and marks the changed ones for the end sync
+func SyncDevice(device *models.GeneralDevice, rDevice *models.RelutionDevice) {
+	details := models.RelutionDeviceToDeviceDetails(device.Id, *rDevice)
+	if old, exists := oldDetails[device.Id]; !exists || models.HasObjectChanged(old, *details) {
+		changedDetails = append(changedDetails, *details)
+	}
+
+	apps := models.RelutionDeviceToInstalledApps(device.Id, *rDevice)
+	sortApps(apps)
+	if old := oldApps[device.Id]; !(len(old) == 0 && len(apps) == 0) && !reflect.DeepEqual(old, apps) {
+		changedApps[device.Id] = apps
+	}
+
+	profiles := models.RelutionDeviceToDeviceProfiles(device.Id, *rDevice)
+	sortProfiles(profiles)
+	if old := oldProfiles[device.Id]; !(len(old) == 0 && len(profiles) == 0) && !reflect.DeepEqual(old, profiles) {
+		changedProfiles[device.Id] = profiles
+	}
+}
+
+// Sorts the apps by their identifiers in byte order, which differs from the case insensitive order of MySQL
+func sortApps(apps []models.InstalledApp) {
+	sort.Slice(apps, func(i, j int) bool {
+		return apps[i].Identifier < apps[j].Identifier
+	})
+}
+
+// Sorts the profiles by their uuids in byte order, which differs from the case insensitive order of MySQL
+func sortProfiles(profiles []models.DeviceProfile) {
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Uuid < profiles[j].Uuid
+	})
+}
+
+// Stores all changed details, apps and profiles
+func EndSync(ctx context.Context, database *database.Database) error {
+	if len(changedDetails) == 0 && len(changedApps) == 0 && len(changedProfiles) == 0 {
+		log.Debugf("No device details changed")
+		return nil
+	}
+	log.Infof("Update details of %d, apps of %d and profiles of %d devices...", len(changedDetails), len(changedApps), len(changedProfiles))
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Warnf("Error starting device details transaction: %v", err)
+		return fmt.Errorf("error starting device details transaction: %v", err)
+	}
+
+	var lastErr error
+	failed := 0
+
+	for _, details := range changedDetails {
+		_, err = tx.ExecContext(ctx,
+			"REPLACE INTO device_details VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			details.Id,
+			details.Platform,
+			details.Manufacturer,
+			details.Model,
+			details.ModelName,
+			details.ProductName,
+			details.SerialNumber,
+			details.OsVersion,
+			details.BuildVersion,
+			details.DeviceCapacity,
+			details.AvailableDeviceCapacity,
+			details.IsSupervised,
+			details.IsActivationLockEnabled,
+			details.IsDeviceLocatorServiceEnabled,
+			details.IsCloudBackupEnabled,
+			details.Jailbroken,
+			details.EnrollmentDate.UTC().Format(helper.SqlDateFormat),
+			details.Timestamp.UTC().Format(helper.SqlDateFormat),
+		)
+		if err != nil {
+			log.Warnf("Error updating device details: %v", err)
+			lastErr = err
+			failed++
+		}
+	}
+
+	for id, apps := range changedApps {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM device_apps WHERE id = ?", id); err != nil {
+			log.Warnf("Error removing installed apps: %v", err)
+			lastErr = err
+			failed++
+			continue
+		}
+		for _, app := range apps {
+			_, err = tx.ExecContext(ctx,
+				"INSERT INTO device_apps VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+				app.Id,
+				app.Identifier,
+				app.Name,
+				app.Version,
+				app.ShortVersion,
+				app.Managed,
+				app.HasUpdateAvailable,
+				app.BundleSize,
+				app.DynamicSize,
+			)
+			if err != nil {
+				log.Warnf("Error adding installed app: %v", err)
+				lastErr = err
+				failed++
+			}
+		}
+	}
+
+	for id, profiles := range changedProfiles {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM device_profiles WHERE id = ?", id); err != nil {
+			log.Warnf("Error removing device profiles: %v", err)
+			lastErr = err
+			failed++
+			continue
+		}
+		for _, profile := range profiles {
+			_, err = tx.ExecContext(ctx, "INSERT INTO device_profiles VALUES (?, ?, ?, ?)", profile.Id, profile.Uuid, profile.Name, profile.Identifier)
+			if err != nil {
+				log.Warnf("Error adding device profile: %v", err)
+				lastErr = err
+				failed++
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Warnf("Error committing device details: %v", err)
+		return fmt.Errorf("error committing device details: %v", err)
+	}
+	log.Debugf("Updated device details...")
+	if failed > 0 {
+		return fmt.Errorf("error updating %d device details, apps or profiles: %v", failed, lastErr)
+	}
+	return nil
+}
+
+// GetDeviceDetails returns the details, the installed apps and the profiles of the device,
+// or nil if there are no details for the device
+func GetDeviceDetails(ctx context.Context, database *database.Database, id string) (*models.DeviceDetails, []models.InstalledApp, []models.DeviceProfile, error) {
+	details, err := getDetails(ctx, database, "WHERE id = ?", id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	deviceDetails, exists := details[id]
+	if !exists {
+		return nil, nil, nil, nil
+	}
+	apps, err := getApps(ctx, database, "WHERE id = ?", id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	profiles, err := getProfiles(ctx, database, "WHERE id = ?", id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if apps[id] == nil {
+		apps[id] = []models.InstalledApp{}
+	}
+	if profiles[id] == nil {
+		profiles[id] = []models.DeviceProfile{}
+	}
+	return &deviceDetails, apps[id], profiles[id], nil
+}
+
+// GetAllDetails returns the details of all devices
+func GetAllDetails(ctx context.Context, database *database.Database) (map[string]models.DeviceDetails, error) {
+	return getDetails(ctx, database, "")
+}
+
+// GetInstalledApps returns the installed apps of all devices sorted by the identifier
+func GetInstalledApps(ctx context.Context, database *database.Database) (map[string][]models.InstalledApp, error) {
+	return getApps(ctx, database, "")
+}
+
+// Returns all device details matching the filter
+func getDetails(ctx context.Context, database *database.Database, filter string, args ...interface{}) (map[string]models.DeviceDetails, error) {
+	rows, _err := database.DB.QueryContext(ctx, "SELECT * FROM device_details "+filter, args...)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	details := map[string]models.DeviceDetails{}
+	for rows.Next() {
+		entry := models.DeviceDetails{}
+		var enrollment, timestamp mysql.NullTime
+		err := rows.Scan(
+			&entry.Id,
+			&entry.Platform,
+			&entry.Manufacturer,
+			&entry.Model,
+			&entry.ModelName,
+			&entry.ProductName,
+			&entry.SerialNumber,
+			&entry.OsVersion,
+			&entry.BuildVersion,
+			&entry.DeviceCapacity,
+			&entry.AvailableDeviceCapacity,
+			&entry.IsSupervised,
+			&entry.IsActivationLockEnabled,
+			&entry.IsDeviceLocatorServiceEnabled,
+			&entry.IsCloudBackupEnabled,
+			&entry.Jailbroken,
+			&enrollment,
+			&timestamp,
+		)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		if enrollment.Valid {
+			entry.EnrollmentDate = enrollment.Time
+		}
+		if timestamp.Valid {
+			entry.Timestamp = timestamp.Time
+		}
+		details[entry.Id] = entry
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return details, nil
+}
+
+// Returns all installed apps matching the filter sorted by the identifier
+func getApps(ctx context.Context, database *database.Database, filter string, args ...interface{}) (map[string][]models.InstalledApp, error) {
+	rows, _err := database.DB.QueryContext(ctx, "SELECT * FROM device_apps "+filter+" ORDER BY identifier", args...)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	apps := map[string][]models.InstalledApp{}
+	for rows.Next() {
+		app := models.InstalledApp{}
+		err := rows.Scan(&app.Id, &app.Identifier, &app.Name, &app.Version, &app.ShortVersion, &app.Managed, &app.HasUpdateAvailable, &app.BundleSize, &app.DynamicSize)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		apps[app.Id] = append(apps[app.Id], app)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	// Sorted like the synced apps, so unchanged apps are equal
+	for _, deviceApps := range apps {
+		sortApps(deviceApps)
+	}
+	return apps, nil
+}
+
+// Returns all device profiles matching the filter sorted by the uuid
+func getProfiles(ctx context.Context, database *database.Database, filter string, args ...interface{}) (map[string][]models.DeviceProfile, error) {
+	rows, _err := database.DB.QueryContext(ctx, "SELECT * FROM device_profiles "+filter+" ORDER BY uuid", args...)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	profiles := map[string][]models.DeviceProfile{}
+	for rows.Next() {
+		profile := models.DeviceProfile{}
+		err := rows.Scan(&profile.Id, &profile.Uuid, &profile.Name, &profile.Identifier)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		profiles[profile.Id] = append(profiles[profile.Id], profile)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	// Sorted like the synced profiles, so unchanged profiles are equal
+	for _, deviceProfiles := range profiles {
+		sortProfiles(deviceProfiles)
+	}
+	return profiles, nil
+}
@@ -0,0 +1,46 @@
+package details
+
+import (
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/export"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+func Serve(root *gin.RouterGroup, database *database.Database) {
+	root.GET("/devices/:id/details", func(c *gin.Context) {
+		details, apps, profiles, err := GetDeviceDetails(c.Request.Context(), database, c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if details == nil {
+			c.JSON(404, gin.H{"error": "Device not found"})
+			return
+		}
+		c.JSON(200, gin.H{"details": details, "apps": apps, "profiles": profiles})
+	})
+
+	root.GET("/details", func(c *gin.Context) {
+		details, err := GetAllDetails(c.Request.Context(), database)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if export.GetFormat(c) != "" {
+			list := make([]models.DeviceDetails, 0, len(details))
+			for _, deviceDetails := range details {
+				list = append(list, deviceDetails)
+			}
+			sort.Slice(list, func(i, j int) bool {
+				return list[i].Id < list[j].Id
+			})
+			export.Respond(c, "devices", list)
+			return
+		}
+		c.JSON(200, gin.H{"devices": details})
+	})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/export"
+	"github.com/viktoriaschule/management-server/history"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/relution"
+)
+
+var (
+	exportFormat string
+	exportOutput string
+	exportFilter relution.DeviceFilter
+	exportGroup  int64
+	exportType   int64
+	exportIds    string
+	exportFrom   string
+	exportTo     string
+	exportStale  bool
+)
+
+func init() {
+	exportCmd.PersistentFlags().StringVar(&exportFormat, "format", export.CsvFormat, "Export format (csv or xlsx)")
+	exportCmd.PersistentFlags().StringVarP(&exportOutput, "output", "o", "-", "Output file, - for stdout")
+
+	exportDevicesCmd.Flags().Int64Var(&exportGroup, "group", 0, "Only devices of the group")
+	exportDevicesCmd.Flags().StringVar(&exportFilter.GroupIndex, "group-index", "", "Only devices with the group index")
+	exportDevicesCmd.Flags().Int64Var(&exportType, "type", 0, "Only devices of the type")
+	exportDevicesCmd.Flags().StringVar(&exportFilter.Status, "status", "", "Only devices with the status")
+	exportDevicesCmd.Flags().StringVar(&exportFilter.User, "user", "", "Only devices with the logged in user")
+
+	exportHistoryCmd.Flags().StringVar(&exportIds, "ids", "", "Comma separated device ids, all devices if empty")
+	exportHistoryCmd.Flags().StringVar(&exportFrom, "from", "", "Oldest date (YYYY-MM-DD)")
+	exportHistoryCmd.Flags().StringVar(&exportTo, "to", "", "Newest date (YYYY-MM-DD), which is included")
+
+	exportReportCmd.Flags().StringVar(&exportFrom, "from", "", "Oldest day of usage reports (YYYY-MM-DD)")
+	exportReportCmd.Flags().StringVar(&exportTo, "to", "", "Newest day of usage reports (YYYY-MM-DD)")
+	exportReportCmd.Flags().BoolVar(&exportStale, "include-stale", false, "Include stale devices in the missing devices report")
+
+	exportCmd.AddCommand(exportDevicesCmd, exportHistoryCmd, exportReportCmd)
+	rootCmd.AddCommand(exportCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export devices, history or reports as csv or xlsx",
+}
+
+var exportDevicesCmd = &cobra.Command{
+	Use:   "devices",
+	Short: "Export the device list",
+	Run: func(cmd *cobra.Command, args []string) {
+		if cmd.Flags().Changed("group") {
+			exportFilter.Group = &exportGroup
+		}
+		if cmd.Flags().Changed("type") {
+			exportFilter.Type = &exportType
+		}
+		runExport(cmd, func(ctx context.Context, db *database.Database, c *config.Config, writer export.Writer) error {
+			return relution.ExportDevices(ctx, db, exportFilter, writer)
+		})
+	},
+}
+
+var exportHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Export the device history",
+	Run: func(cmd *cobra.Command, args []string) {
+		request := history.Request{}
+		if exportIds != "" {
+			request.Ids = strings.Split(exportIds, ",")
+		}
+		request.Date = parseExportDate(exportFrom, time.Local)
+		// The end is exclusive, so the named day is included until its end
+		if to := parseExportDate(exportTo, time.Local); !to.IsZero() {
+			request.To = to.AddDate(0, 0, 1)
+		}
+		runExport(cmd, func(ctx context.Context, db *database.Database, c *config.Config, writer export.Writer) error {
+			return history.ExportHistory(ctx, db, request, writer)
+		})
+	},
+}
+
+var exportReportCmd = &cobra.Command{
+	Use:   "report <name>",
+	Short: "Export a report",
+	Long:  "Export a report, one of: " + strings.Join(reportNames(), ", "),
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		report, exists := reports[args[0]]
+		if !exists {
+			log.Errorf("Unknown report %s, expected one of: %s", args[0], strings.Join(reportNames(), ", "))
+			os.Exit(1)
+		}
+		runExport(cmd, func(ctx context.Context, db *database.Database, c *config.Config, writer export.Writer) error {
+			devices, err := relution.GetValidLoadedDevices(ctx, db)
+			if err != nil {
+				return err
+			}
+			list, err := report(ctx, db, c, *devices)
+			if err != nil {
+				return err
+			}
+			return export.WriteList(writer, list)
+		})
+	},
+}
+
+// Opens the output and the database and runs the export
+func runExport(cmd *cobra.Command, run func(ctx context.Context, db *database.Database, c *config.Config, writer export.Writer) error) {
+	c := loadConfig(configOptions(cmd))
+	// Logs must not be mixed into an export written to stdout
+	if exportOutput == "-" && (c.Log.Output == "" || c.Log.Output == "stdout") {
+		c.Log.Output = "stderr"
+	}
+	configureLogging(c)
+
+	var output io.Writer = os.Stdout
+	if exportOutput != "-" {
+		file, err := os.Create(exportOutput)
+		if err != nil {
+			log.Errorf("Cannot create output file: %v", err)
+			os.Exit(1)
+		}
+		//noinspection GoUnhandledErrorResult
+		defer file.Close()
+		output = file
+	}
+
+	writer, err := export.NewWriter(exportFormat, output)
+	if err != nil {
+		log.Errorf("%v", err)
+		os.Exit(1)
+	}
+
+	db := database.NewDatabase(c)
+	if err = run(context.Background(), db, c, writer); err != nil {
+		log.Errorf("Export failed: %v", err)
+		os.Exit(1)
+	}
+}
+
+// Parses the date of a flag in the location, the history uses local days and the usage statistics UTC days
+func parseExportDate(value string, location *time.Location) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, location)
+	if err != nil {
+		log.Errorf("Invalid date %s: %v", value, err)
+		os.Exit(1)
+	}
+	return date
+}
@@ -0,0 +1,202 @@
+package export
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/viktoriaschule/management-server/log"
+)
+
+// The supported export formats
+const (
+	CsvFormat  = "csv"
+	XlsxFormat = "xlsx"
+)
+
+// The content types of the export formats
+var contentTypes = map[string]string{
+	CsvFormat:  "text/csv; charset=utf-8",
+	XlsxFormat: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// GetFormat returns the requested export format of the request, or an empty string for json
+func GetFormat(c *gin.Context) string {
+	return c.Query("format")
+}
+
+// IsSupportedFormat returns if the format is an export format
+func IsSupportedFormat(format string) bool {
+	_, exists := contentTypes[format]
+	return exists
+}
+
+// Respond writes the list as the requested export format, or as json with the given key
+func Respond(c *gin.Context, key string, list interface{}) {
+	format := GetFormat(c)
+	if format == "" {
+		c.JSON(200, gin.H{key: list})
+		return
+	}
+
+	writer, ok := StartResponse(c, key, format)
+	if !ok {
+		return
+	}
+	if err := WriteList(writer, list); err != nil {
+		log.Warnf("Error writing export: %v", err)
+	}
+}
+
+// WriteList writes all structs of the slice as rows and closes the writer
+func WriteList(writer Writer, list interface{}) error {
+	value := reflect.ValueOf(list)
+	table := NewTableWriter(writer, value.Type().Elem())
+	for i := 0; i < value.Len(); i++ {
+		if err := table.Write(value.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return table.Close()
+}
+
+// StartResponse sets the headers of an export download and returns the writer for the response,
+// if the format is not supported, an error is responded
+func StartResponse(c *gin.Context, name string, format string) (Writer, bool) {
+	if !IsSupportedFormat(format) {
+		c.JSON(400, gin.H{"error": "Unknown export format"})
+		return nil, false
+	}
+	c.Header("Content-Type", contentTypes[format])
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, name, time.Now().Format("2006-01-02"), format))
+	c.Status(200)
+	writer, err := NewWriter(format, c.Writer)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return writer, true
+}
+
+// TableWriter writes structs as rows, with one column per field
+type TableWriter struct {
+	writer        Writer
+	columns       []column
+	headerWritten bool
+}
+
+type column struct {
+	name  string
+	index []int
+}
+
+// NewTableWriter returns a writer for structs of the given type,
+// nested structs are flattened with their name as prefix
+func NewTableWriter(writer Writer, structType reflect.Type) *TableWriter {
+	for structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	return &TableWriter{writer: writer, columns: getColumns(structType, "", nil)}
+}
+
+// Write writes the header, if not done yet, and the struct as one row
+func (t *TableWriter) Write(item interface{}) error {
+	if !t.headerWritten {
+		if err := t.writeHeader(); err != nil {
+			return err
+		}
+	}
+	value := reflect.ValueOf(item)
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	row := make([]interface{}, len(t.columns))
+	for i, column := range t.columns {
+		row[i] = getFieldValue(value, column.index)
+	}
+	return t.writer.WriteRow(row)
+}
+
+// Close writes the header, if there were no rows, and closes the writer
+func (t *TableWriter) Close() error {
+	if !t.headerWritten {
+		if err := t.writeHeader(); err != nil {
+			return err
+		}
+	}
+	return t.writer.Close()
+}
+
+func (t *TableWriter) writeHeader() error {
+	t.headerWritten = true
+	header := make([]interface{}, len(t.columns))
+	for i, column := range t.columns {
+		header[i] = column.name
+	}
+	return t.writer.WriteRow(header)
+}
+
+// Returns the columns of all exported fields named by their json name
+func getColumns(structType reflect.Type, prefix string, index []int) []column {
+	var columns []column
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fieldIndex := append(append([]int{}, index...), i)
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if fieldType.Kind() == reflect.Struct && fieldType != reflect.TypeOf(time.Time{}) {
+			if field.Anonymous {
+				columns = append(columns, getColumns(fieldType, prefix, fieldIndex)...)
+			} else {
+				columns = append(columns, getColumns(fieldType, prefix+name+"_", fieldIndex)...)
+			}
+			continue
+		}
+		columns = append(columns, column{name: prefix + name, index: fieldIndex})
+	}
+	return columns
+}
+
+// Returns the value of the nested field, or nil if a pointer on the way is nil
+func getFieldValue(value reflect.Value, index []int) interface{} {
+	for _, i := range index {
+		for value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return nil
+			}
+			value = value.Elem()
+		}
+		value = value.Field(i)
+	}
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int()
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	case reflect.Slice, reflect.Map:
+		return fmt.Sprintf("%v", value.Interface())
+	}
+	return value.Interface()
+}
@@ -0,0 +1,161 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Writer writes table rows to a file format
+type Writer interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// NewWriter returns a writer for the format, which writes all rows directly to the output
+func NewWriter(format string, output io.Writer) (Writer, error) {
+	switch format {
+	case CsvFormat:
+		return &csvWriter{writer: csv.NewWriter(output)}, nil
+	case XlsxFormat:
+		return newXlsxWriter(output)
+	}
+	return nil, errors.Errorf("Unknown export format %s", format)
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch value.(type) {
+		case int, int64, float64:
+			record[i] = formatValue(value)
+		default:
+			record[i] = escapeFormula(formatValue(value))
+		}
+	}
+	return w.writer.Write(record)
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// The static parts of a workbook with one worksheet
+var xlsxFiles = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Export" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// Writes a workbook with one worksheet, the rows are streamed into the worksheet
+type xlsxWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+}
+
+func newXlsxWriter(output io.Writer) (*xlsxWriter, error) {
+	archive := zip.NewWriter(output)
+	for _, file := range xlsxFiles {
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.WriteString(writer, file.content); err != nil {
+			return nil, err
+		}
+	}
+
+	// The worksheet must be the last file, because it is written until the writer is closed
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	w := &xlsxWriter{archive: archive, sheet: bufio.NewWriter(sheet)}
+	_, err = w.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return w, err
+}
+
+func (w *xlsxWriter) WriteRow(values []interface{}) error {
+	if _, err := w.sheet.WriteString("<row>"); err != nil {
+		return err
+	}
+	for _, value := range values {
+		var err error
+		switch value.(type) {
+		case int, int64, float64:
+			_, err = fmt.Fprintf(w.sheet, "<c><v>%s</v></c>", formatValue(value))
+		default:
+			if _, err = w.sheet.WriteString(`<c t="inlineStr"><is><t>`); err != nil {
+				return err
+			}
+			// Inline strings are never evaluated, so they are not escaped like csv cells
+			if err = xml.EscapeText(w.sheet, []byte(formatValue(value))); err != nil {
+				return err
+			}
+			_, err = w.sheet.WriteString("</t></is></c>")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.sheet.WriteString("</row>")
+	return err
+}
+
+func (w *xlsxWriter) Close() error {
+	if _, err := w.sheet.WriteString("</sheetData></worksheet>"); err != nil {
+		return err
+	}
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.archive.Close()
+}
+
+// Prefixes texts that spreadsheet applications would evaluate as formulas when opening a csv file
+// (e.g. =HYPERLINK(...)) with an apostrophe, so names and notes are always shown as text
+func escapeFormula(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// Returns the value as a cell text
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%v", value)
+}
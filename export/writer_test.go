@@ -0,0 +1,147 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testRow struct {
+	Id      string     `json:"id"`
+	Level   int        `json:"level"`
+	Percent float64    `json:"percent"`
+	Note    string     `json:"note"`
+	Due     *time.Time `json:"due"`
+	Details struct {
+		Model string `json:"model"`
+	} `json:"details"`
+	Hidden string `json:"-"`
+}
+
+func testRows() []testRow {
+	due := time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC)
+	first := testRow{Id: "a1", Level: 80, Percent: 12.5, Note: "=HYPERLINK(\"http://example.com\")", Due: &due, Hidden: "secret"}
+	first.Details.Model = "iPad"
+	second := testRow{Id: "b2", Level: -3, Percent: 0, Note: "Klasse 5a, \"Raum\" 12"}
+	return []testRow{first, second}
+}
+
+func TestCsvWriter(t *testing.T) {
+	var output bytes.Buffer
+	writer, err := NewWriter(CsvFormat, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteList(writer, testRows()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "id,level,percent,note,due,details_model\n" +
+		"a1,80,12.5,\"'=HYPERLINK(\"\"http://example.com\"\")\",2020-05-01T12:30:00Z,iPad\n" +
+		"b2,-3,0,\"Klasse 5a, \"\"Raum\"\" 12\",,\n"
+	if output.String() != expected {
+		t.Errorf("Unexpected csv:\n%s\nexpected:\n%s", output.String(), expected)
+	}
+}
+
+func TestCsvWriterWithoutRows(t *testing.T) {
+	var output bytes.Buffer
+	writer, err := NewWriter(CsvFormat, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteList(writer, []testRow{}); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "id,level,percent,note,due,details_model\n" {
+		t.Errorf("Expected only the header, got %q", output.String())
+	}
+}
+
+func TestXlsxWriter(t *testing.T) {
+	var output bytes.Buffer
+	writer, err := NewWriter(XlsxFormat, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteList(writer, testRows()); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("Invalid zip archive: %v", err)
+	}
+	files := map[string]string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name] = string(content)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		if _, exists := files[name]; !exists {
+			t.Errorf("Missing file %s", name)
+		}
+	}
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	expectedCells := []string{
+		`<c t="inlineStr"><is><t>id</t></is></c>`,
+		`<c t="inlineStr"><is><t>details_model</t></is></c>`,
+		`<c><v>80</v></c>`,
+		`<c><v>12.5</v></c>`,
+		`<c><v>-3</v></c>`,
+		// Inline strings are not evaluated, so the value is kept unchanged
+		`<c t="inlineStr"><is><t>=HYPERLINK(&#34;http://example.com&#34;)</t></is></c>`,
+		`<c t="inlineStr"><is><t>2020-05-01T12:30:00Z</t></is></c>`,
+		`<c t="inlineStr"><is><t></t></is></c>`,
+	}
+	for _, cell := range expectedCells {
+		if !strings.Contains(sheet, cell) {
+			t.Errorf("Missing cell %s in sheet:\n%s", cell, sheet)
+		}
+	}
+	if strings.Contains(sheet, "secret") {
+		t.Errorf("Field without json name was exported")
+	}
+	if count := strings.Count(sheet, "<row>"); count != 3 {
+		t.Errorf("Expected 3 rows, got %d", count)
+	}
+	if !strings.HasSuffix(sheet, "</sheetData></worksheet>") {
+		t.Errorf("Worksheet is not closed")
+	}
+}
+
+func TestEscapeFormula(t *testing.T) {
+	tests := map[string]string{
+		"=1+1":        "'=1+1",
+		"+49 241 123": "'+49 241 123",
+		"-5":          "'-5",
+		"@SUM(A1)":    "'@SUM(A1)",
+		"\tcmd":       "'\tcmd",
+		"\rcmd":       "'\rcmd",
+		"l.mueller":   "l.mueller",
+		"a=b":         "a=b",
+		"":            "",
+	}
+	for text, expected := range tests {
+		if escaped := escapeFormula(text); escaped != expected {
+			t.Errorf("escapeFormula(%q) = %q, expected %q", text, escaped, expected)
+		}
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := NewWriter("pdf", &bytes.Buffer{}); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/viktoriaschule/management-server/apps"
+	"github.com/viktoriaschule/management-server/compliance"
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/connection"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/groups"
+	"github.com/viktoriaschule/management-server/lending"
+	"github.com/viktoriaschule/management-server/models"
+	"github.com/viktoriaschule/management-server/osupdate"
+	"github.com/viktoriaschule/management-server/storage"
+	"github.com/viktoriaschule/management-server/usage"
+)
+
+// A report returns a slice of structs, which are exported as rows
+type report func(ctx context.Context, db *database.Database, c *config.Config, devices []models.GeneralDevice) (interface{}, error)
+
+// The reports of the export command by their names, the same reports are served by the API
+var reports = map[string]report{
+	"apps-missing": func(ctx context.Context, db *database.Database, c *config.Config, devices []models.GeneralDevice) (interface{}, error) {
+		return apps.GetMissingApps(ctx, db, c, devices)
+	},
+	"apps-outdated": func(ctx context.Context, db *database.Database, c *config.Config, devices []models.GeneralDevice) (interface{}, error) {
+		return apps.GetOutdatedApps(ctx, db, c, devices)
+	},
+	"apps-updates": func(ctx context.Context, db *database.Database, c *config.Config, devices []models.GeneralDevice) (interface{}, error) {
+		return apps.GetAvailableUpdates(ctx, db, devices)
+	},
+	"compliance": func(ctx context.Context, db *database.Database, c *config.Config, devices []models.GeneralDevice) (interface{}, error) {
+		return compliance.GetViolatingDevices(ctx, db, devices)
+	},
+	"devices-missing": func(ctx context.Context, db *database.Database, c *config.Config, devices []models.GeneralDevice) (interface{}, error) {
+		return connection.GetMissingDevices(ctx, db, devices, exportStale)
+	},
+	"groups": func(ctx context.Context, db *database.Database, c *config.Config, devices []models.GeneralDevice) (interface{}, error) {
+		return groups.GetGroups(ctx, db)
+	},
+	"lendings-unreturned": func(ctx context.Context, db *database.Database, c *config.Config, devices []models.GeneralDevice) (interface{}, error) {
+		return lending.GetUnreturnedLendings(ctx, db)
+	},
+	"lendings-overdue": func(ctx context.Context, db *database.Database, c *config.Config, devices []models.GeneralDevice) (interface{}, error) {
+		return lending.GetOverdueLendings(ctx, db)
+	},
+	"os-noncompliant": func(ctx context.Context, db *database.Database, c *config.Config, devices []models.GeneralDevice) (interface{}, error) {
+		return osupdate.GetNonCompliantDevices(ctx, db, c, devices)
+	},
+	"os-stalled": func(ctx context.Context, db *database.Database, c *config.Config, devices []models.GeneralDevice) (interface{}, error) {
+		return osupdate.GetStalledUpdates(ctx, db, c, devices)
+	},
+	"storage": func(ctx context.Context, db *database.Database, c *config.Config, devices []models.GeneralDevice) (interface{}, error) {
+		return storage.GetStorageReport(ctx, db, c, devices, false)
+	},
+	"storage-nearly-full": func(ctx context.Context, db *database.Database, c *config.Config, devices []models.GeneralDevice) (interface{}, error) {
+		return storage.GetStorageReport(ctx, db, c, devices, true)
+	},
+	"usage-users":   usageReport(usage.UserScope),
+	"usage-groups":  usageReport(usage.GroupScope),
+	"usage-devices": usageReport(usage.DeviceScope),
+}
+
+// Returns the usage report of the scope in the days of the --from and --to flags
+func usageReport(scope string) report {
+	return func(ctx context.Context, db *database.Database, c *config.Config, devices []models.GeneralDevice) (interface{}, error) {
+		if exportFrom == "" {
+			return nil, fmt.Errorf("usage reports require --from")
+		}
+		request := usage.ReportRequest{From: parseExportDate(exportFrom, time.UTC), To: parseExportDate(exportTo, time.UTC)}
+		return usage.GetReport(ctx, db, scope, request)
+	}
+}
+
+// Returns the names of all reports sorted alphabetically
+func reportNames() []string {
+	names := make([]string, 0, len(reports))
+	for name := range reports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
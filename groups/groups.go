@@ -0,0 +1,173 @@
+package groups
+
+import (
+	"context"
+	"sort"
+
+	"github.com/viktoriaschule/management-server/connection"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+	"github.com/viktoriaschule/management-server/relution"
+)
+
+// GetGroups returns all configured groups and all groups found in the device names
+// with the aggregated device states
+func GetGroups(ctx context.Context, database *database.Database) ([]models.DeviceGroupStatus, error) {
+	groups, err := getGroups(ctx, database, "")
+	if err != nil {
+		return nil, err
+	}
+	devices, err := relution.GetValidLoadedDevices(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	connections, err := connection.GetConnections(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add all groups which are only known by the device names
+	known := map[int64]bool{}
+	for _, group := range groups {
+		known[group.Id] = true
+	}
+	for _, device := range *devices {
+		if device.DeviceGroup != 0 && !known[device.DeviceGroup] {
+			known[device.DeviceGroup] = true
+			groups = append(groups, models.DeviceGroup{Id: device.DeviceGroup})
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Id < groups[j].Id
+	})
+
+	statuses := []models.DeviceGroupStatus{}
+	for _, group := range groups {
+		statuses = append(statuses, *getGroupStatus(group, *devices, connections))
+	}
+	return statuses, nil
+}
+
+// GetGroup returns the group with the aggregated device states and all devices of the group,
+// or nil if there is neither a configured group nor a device in the group
+func GetGroup(ctx context.Context, database *database.Database, id int64) (*models.DeviceGroupStatus, []models.GeneralDevice, error) {
+	groups, err := getGroups(ctx, database, "WHERE id = ?", id)
+	if err != nil {
+		return nil, nil, err
+	}
+	devices, err := relution.GetValidLoadedDevices(ctx, database)
+	if err != nil {
+		return nil, nil, err
+	}
+	connections, err := connection.GetConnections(ctx, database)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	groupDevices := []models.GeneralDevice{}
+	for _, device := range *devices {
+		if device.DeviceGroup == id {
+			groupDevices = append(groupDevices, device)
+		}
+	}
+
+	if len(groups) == 0 {
+		if len(groupDevices) == 0 {
+			return nil, nil, nil
+		}
+		groups = append(groups, models.DeviceGroup{Id: id})
+	}
+
+	return getGroupStatus(groups[0], groupDevices, connections), groupDevices, nil
+}
+
+// SetGroup adds or updates the group
+func SetGroup(ctx context.Context, database *database.Database, group models.DeviceGroup) error {
+	_, err := database.DB.ExecContext(ctx,
+		"INSERT INTO device_groups VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE name = ?, location = ?, responsible_teacher = ?, expected_devices = ?",
+		group.Id,
+		group.Name,
+		group.Location,
+		group.ResponsibleTeacher,
+		group.ExpectedDevices,
+		group.Name,
+		group.Location,
+		group.ResponsibleTeacher,
+		group.ExpectedDevices,
+	)
+	if err != nil {
+		log.Errorf("Error setting device group: %v", err)
+		return &helper.LoadError{Msg: "Database query failed"}
+	}
+	return nil
+}
+
+// RemoveGroup removes the group configuration, the devices are still in the group
+func RemoveGroup(ctx context.Context, database *database.Database, id int64) (bool, error) {
+	result, err := database.DB.ExecContext(ctx, "DELETE FROM device_groups WHERE id = ?", id)
+	if err != nil {
+		log.Errorf("Error removing device group: %v", err)
+		return false, &helper.LoadError{Msg: "Database query failed"}
+	}
+	count, _ := result.RowsAffected()
+	return count > 0, nil
+}
+
+// Aggregates the states of all devices in the group,
+// devices with a missing connection state are counted as missing
+func getGroupStatus(group models.DeviceGroup, devices []models.GeneralDevice, connections map[string]models.DeviceConnection) *models.DeviceGroupStatus {
+	status := &models.DeviceGroupStatus{DeviceGroup: group}
+	var batterySum int64
+	var missing int64
+	for _, device := range devices {
+		if device.DeviceGroup != group.Id {
+			continue
+		}
+		if connections[device.Id].State == connection.Missing {
+			missing++
+			continue
+		}
+		status.Present++
+		batterySum += device.BatteryLevel
+		if device.IsCharging {
+			status.Charging++
+		}
+	}
+	if status.Present > 0 {
+		status.AverageBattery = float64(batterySum) / float64(status.Present)
+	}
+	status.Missing = missing
+	if group.ExpectedDevices > status.Present+missing {
+		status.Missing = group.ExpectedDevices - status.Present
+	}
+	return status
+}
+
+// Returns all configured groups matching the filter
+func getGroups(ctx context.Context, database *database.Database, filter string, args ...interface{}) ([]models.DeviceGroup, error) {
+	rows, _err := database.DB.QueryContext(ctx, "SELECT * FROM device_groups "+filter, args...)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	groups := []models.DeviceGroup{}
+	for rows.Next() {
+		group := models.DeviceGroup{}
+		err := rows.Scan(&group.Id, &group.Name, &group.Location, &group.ResponsibleTeacher, &group.ExpectedDevices)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return groups, nil
+}
@@ -0,0 +1,87 @@
+package groups
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/viktoriaschule/management-server/audit"
+	"github.com/viktoriaschule/management-server/auth"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/export"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+func Serve(root *gin.RouterGroup, admin *gin.RouterGroup, database *database.Database) {
+	root.GET("/groups", func(c *gin.Context) {
+		groups, err := GetGroups(c.Request.Context(), database)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "groups", groups)
+	})
+
+	root.GET("/groups/:id", func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid group id"})
+			return
+		}
+		group, devices, err := GetGroup(c.Request.Context(), database, id)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if group == nil {
+			c.JSON(404, gin.H{"error": "Group not found"})
+			return
+		}
+		c.JSON(200, gin.H{"group": group, "devices": devices})
+	})
+
+	admin.PUT("/groups/:id", func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil || id <= 0 {
+			c.JSON(400, gin.H{"error": "Invalid group id"})
+			return
+		}
+		request := GroupRequest{}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(400, gin.H{"error": "Wrong body format"})
+			return
+		}
+		group := models.DeviceGroup{
+			Id:                 id,
+			Name:               request.Name,
+			Location:           request.Location,
+			ResponsibleTeacher: request.ResponsibleTeacher,
+			ExpectedDevices:    request.ExpectedDevices,
+		}
+		if err := SetGroup(c.Request.Context(), database, group); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		audit.RecordAction(database, auth.GetUser(c).Username, "set_group", group)
+		c.JSON(200, gin.H{"group": group})
+	})
+
+	admin.DELETE("/groups/:id", func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid group id"})
+			return
+		}
+		removed, err := RemoveGroup(c.Request.Context(), database, id)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if !removed {
+			c.JSON(404, gin.H{"error": "Group not found"})
+			return
+		}
+		audit.RecordAction(database, auth.GetUser(c).Username, "remove_group", gin.H{"id": id})
+		c.JSON(200, gin.H{})
+	})
+}
@@ -0,0 +1,8 @@
+package groups
+
+type GroupRequest struct {
+	Name               string `json:"name"`
+	Location           string `json:"location"`
+	ResponsibleTeacher string `json:"responsible_teacher"`
+	ExpectedDevices    int64  `json:"expected_devices"`
+}
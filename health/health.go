@@ -0,0 +1,92 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/schedule"
+)
+
+// The check results
+const (
+	ok     = "ok"
+	failed = "failed"
+)
+
+// The detail of failed connection checks, which is public unlike the errors
+const unreachable = "Unreachable"
+
+// CheckReadiness runs all readiness checks and returns if all succeeded
+func CheckReadiness(ctx context.Context, database *database.Database, config *config.Config, syncSchedule schedule.Schedule, lastSync time.Time) (bool, map[string]Check) {
+	checks := map[string]Check{
+		"database": checkDatabase(ctx, database),
+		"relution": checkSync(config, syncSchedule, lastSync),
+		"ldap":     checkLdap(ctx, config),
+	}
+	for _, check := range checks {
+		if check.Status != ok {
+			return false, checks
+		}
+	}
+	return true, checks
+}
+
+// Checks if the database is reachable
+func checkDatabase(ctx context.Context, database *database.Database) Check {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	if err := database.DB.PingContext(ctx); err != nil {
+		// The error contains the host and user of the database, so it is only logged
+		log.Warnf("Database readiness check failed: %v", err)
+		return Check{Status: failed, Detail: unreachable}
+	}
+	return Check{Status: ok}
+}
+
+// Checks if the last successful relution sync is not too old,
+// by default the sync may miss one scheduled run after the last successful one
+func checkSync(config *config.Config, syncSchedule schedule.Schedule, lastSync time.Time) Check {
+	if lastSync.IsZero() {
+		return Check{Status: failed, Detail: "No successful sync yet"}
+	}
+	maxSyncAge := config.Health.MaxSyncAge
+	if maxSyncAge <= 0 && syncSchedule != nil {
+		if next := syncSchedule.Next(lastSync); !next.IsZero() {
+			maxSyncAge = next.Sub(lastSync) * maxMissedSyncs
+		}
+	}
+	age := time.Since(lastSync)
+	detail := fmt.Sprintf("Last successful sync %s ago", age.Truncate(time.Second))
+	if maxSyncAge > 0 && age > maxSyncAge {
+		return Check{Status: failed, Detail: detail}
+	}
+	return Check{Status: ok, Detail: detail}
+}
+
+// Checks if the ldap API responds, without credentials an unauthorized response is expected
+func checkLdap(ctx context.Context, config *config.Config) Check {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	// The errors contain the secret ldap url, so they are only logged
+	request, err := http.NewRequestWithContext(ctx, "GET", config.LdapUrl(), nil)
+	if err != nil {
+		log.Warnf("Ldap readiness check failed: %v", err)
+		return Check{Status: failed, Detail: unreachable}
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		log.Warnf("Ldap readiness check failed: %v", err)
+		return Check{Status: failed, Detail: unreachable}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer response.Body.Close()
+	if response.StatusCode >= 500 {
+		return Check{Status: failed, Detail: fmt.Sprintf("Status code %d", response.StatusCode)}
+	}
+	return Check{Status: ok}
+}
@@ -0,0 +1,29 @@
+package health
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/schedule"
+)
+
+func Serve(r gin.IRoutes, database *database.Database, getConfig func() *config.Config, syncSchedule func(*config.Config) (schedule.Schedule, error), lastSync func() time.Time) {
+	r.GET("/healthz", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": ok})
+	})
+
+	r.GET("/readyz", func(c *gin.Context) {
+		config := getConfig()
+		// The config is validated, so the schedule is only missing if it cannot be parsed
+		jobSchedule, _ := syncSchedule(config)
+		ready, checks := CheckReadiness(c.Request.Context(), database, config, jobSchedule, lastSync())
+		if !ready {
+			c.JSON(503, gin.H{"status": "not ready", "checks": checks})
+			return
+		}
+		c.JSON(200, gin.H{"status": "ready", "checks": checks})
+	})
+}
@@ -0,0 +1,14 @@
+package health
+
+import "time"
+
+// The timeout of every readiness check
+const checkTimeout = time.Second * 2
+
+// The number of sync gaps after which the last successful sync is too old by default
+const maxMissedSyncs = 2
+
+type Check struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
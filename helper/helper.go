@@ -1,26 +1,13 @@
 package helper
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 var SqlDateFormat = "2006-01-02 15:04:05"
 
-func Schedule(what func(), delay time.Duration) chan bool {
-	stop := make(chan bool)
-
-	go func() {
-		for {
-			what()
-			select {
-			case <-time.After(delay):
-			case <-stop:
-				return
-			}
-		}
-	}()
-
-	return stop
-}
-
 func (e *LoadError) Error() string {
 	return e.Msg
 }
@@ -28,3 +15,46 @@ func (e *LoadError) Error() string {
 type LoadError struct {
 	Msg string
 }
+
+// ParseVersion returns the numeric parts of a dot separated version string (e.g. 13.4.1)
+func ParseVersion(version string) ([]int64, error) {
+	parts := strings.Split(strings.TrimSpace(version), ".")
+	numbers := make([]int64, len(parts))
+	for i, part := range parts {
+		number, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || number < 0 {
+			return nil, fmt.Errorf("version %q has the non numeric part %q", version, part)
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
+
+// CompareVersions compares two dot separated version strings numerically
+// and returns -1, 0 or 1 if v1 is lower, equal or greater than v2.
+// Missing parts are zero, so 14 equals 14.0, but non numeric parts like 14.0-beta are an error
+func CompareVersions(v1 string, v2 string) (int, error) {
+	parts1, err := ParseVersion(v1)
+	if err != nil {
+		return 0, err
+	}
+	parts2, err := ParseVersion(v2)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < len(parts1) || i < len(parts2); i++ {
+		var n1, n2 int64
+		if i < len(parts1) {
+			n1 = parts1[i]
+		}
+		if i < len(parts2) {
+			n2 = parts2[i]
+		}
+		if n1 < n2 {
+			return -1, nil
+		} else if n1 > n2 {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,54 @@
+package helper
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		v1       string
+		v2       string
+		expected int
+	}{
+		{"13.4.1", "13.4.1", 0},
+		{"13.4", "13.4.0", 0},
+		{"14", "14.0.0", 0},
+		{" 14.0 ", "14.0", 0},
+		{"13.4", "13.4.1", -1},
+		{"13.4.1", "13.4", 1},
+		{"9.3", "10.0", -1},
+		{"10.0", "9.3", 1},
+		{"13.10", "13.9", 1},
+		{"1.2.3", "1.3", -1},
+		{"2020.1", "2019.12.31", 1},
+	}
+	for _, test := range tests {
+		result, err := CompareVersions(test.v1, test.v2)
+		if err != nil {
+			t.Errorf("CompareVersions(%q, %q) returned error: %v", test.v1, test.v2, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("CompareVersions(%q, %q) = %d, expected %d", test.v1, test.v2, result, test.expected)
+		}
+	}
+}
+
+func TestCompareVersionsInvalid(t *testing.T) {
+	tests := []struct {
+		v1 string
+		v2 string
+	}{
+		{"14.0-beta", "14.0"},
+		{"14.0", "14.0-beta"},
+		{"", "14.0"},
+		{"14..0", "14.0"},
+		{"14.0.", "14.0"},
+		{"v14", "14"},
+		{"14.-1", "14"},
+		{"1.2.3 (456)", "1.2.3"},
+	}
+	for _, test := range tests {
+		if result, err := CompareVersions(test.v1, test.v2); err == nil {
+			t.Errorf("CompareVersions(%q, %q) = %d, expected an error", test.v1, test.v2, result)
+		}
+	}
+}
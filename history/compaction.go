@@ -0,0 +1,170 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+// The default retention tiers
+const (
+	defaultFullDays   = 30
+	defaultHourlyDays = 365
+	defaultDailyDays  = 365 * 5
+)
+
+// Merges the values of an aggregate into an existing aggregate of the same period,
+// the samples must be updated last, because the assignments are evaluated in order
+const mergeAggregates = `ON DUPLICATE KEY UPDATE
+	level = (level * samples + VALUES(level) * VALUES(samples)) / (samples + VALUES(samples)),
+	min_level = LEAST(min_level, VALUES(min_level)),
+	max_level = GREATEST(max_level, VALUES(max_level)),
+	loggedin_user = VALUES(loggedin_user),
+	status = VALUES(status),
+	samples = samples + VALUES(samples)`
+
+// Compact aggregates all history entries older than the full resolution duration to hourly entries,
+// all hourly entries older than the hourly duration to daily entries
+// and removes all daily entries older than the daily duration
+func Compact(ctx context.Context, database *database.Database, config *config.Config) error {
+	fullDays, hourlyDays, dailyDays := getRetention(config)
+	now := time.Now().UTC()
+
+	// Only complete hours and days are aggregated
+	fullCutoff := now.AddDate(0, 0, -fullDays).Truncate(time.Hour).Format(helper.SqlDateFormat)
+	hourlyCutoff := now.AddDate(0, 0, -hourlyDays).Truncate(time.Hour * 24).Format(helper.SqlDateFormat)
+	dailyCutoff := now.AddDate(0, 0, -dailyDays).Truncate(time.Hour * 24).Format(helper.SqlDateFormat)
+
+	log.Debugf("Compact history entries older than %s...", fullCutoff)
+	err := compactTier(ctx, database,
+		"INSERT INTO history_hourly SELECT id, DATE_FORMAT(timestamp, '%Y-%m-%d %H:00:00') AS period, AVG(level), MIN(level), MAX(level), "+
+			"SUBSTRING_INDEX(GROUP_CONCAT(loggedin_user ORDER BY timestamp DESC), ',', 1), SUBSTRING_INDEX(GROUP_CONCAT(status ORDER BY timestamp DESC), ',', 1), COUNT(*) "+
+			"FROM history WHERE timestamp < ? GROUP BY id, period "+mergeAggregates,
+		"DELETE FROM history WHERE timestamp < ?",
+		fullCutoff,
+	)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Compact hourly history entries older than %s...", hourlyCutoff)
+	err = compactTier(ctx, database,
+		"INSERT INTO history_daily SELECT id, DATE(period) AS day, SUM(level * samples) / SUM(samples), MIN(min_level), MAX(max_level), "+
+			"SUBSTRING_INDEX(GROUP_CONCAT(loggedin_user ORDER BY period DESC), ',', 1), SUBSTRING_INDEX(GROUP_CONCAT(status ORDER BY period DESC), ',', 1), SUM(samples) "+
+			"FROM history_hourly WHERE period < ? GROUP BY id, day "+mergeAggregates,
+		"DELETE FROM history_hourly WHERE period < ?",
+		hourlyCutoff,
+	)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Remove daily history entries older than %s...", dailyCutoff)
+	if _, err := database.DB.ExecContext(ctx, "DELETE FROM history_daily WHERE period < ?", dailyCutoff); err != nil {
+		log.Warnf("Error deleting old daily history entries: %v", err)
+		return fmt.Errorf("error deleting old daily history entries: %v", err)
+	}
+	return nil
+}
+
+// Aggregates and removes the entries of one tier in one transaction
+func compactTier(ctx context.Context, database *database.Database, aggregate string, remove string, cutoff string) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Warnf("Error starting compaction transaction: %v", err)
+		return fmt.Errorf("error starting compaction transaction: %v", err)
+	}
+	if _, err = tx.ExecContext(ctx, aggregate, cutoff); err != nil {
+		log.Warnf("Error aggregating history entries: %v", err)
+		_ = tx.Rollback()
+		return fmt.Errorf("error aggregating history entries: %v", err)
+	}
+	result, err := tx.ExecContext(ctx, remove, cutoff)
+	if err != nil {
+		log.Warnf("Error removing compacted history entries: %v", err)
+		_ = tx.Rollback()
+		return fmt.Errorf("error removing compacted history entries: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		log.Warnf("Error committing compaction: %v", err)
+		return fmt.Errorf("error committing compaction: %v", err)
+	}
+	if count, _ := result.RowsAffected(); count > 0 {
+		log.Infof("Compacted %d history entries", count)
+	}
+	return nil
+}
+
+// Returns the configured retention tiers in days
+func getRetention(config *config.Config) (fullDays int, hourlyDays int, dailyDays int) {
+	fullDays, hourlyDays, dailyDays = config.History.FullDays, config.History.HourlyDays, config.History.DailyDays
+	if fullDays <= 0 {
+		fullDays = defaultFullDays
+	}
+	if hourlyDays <= 0 {
+		hourlyDays = defaultHourlyDays
+	}
+	if dailyDays <= 0 {
+		dailyDays = defaultDailyDays
+	}
+	return fullDays, hourlyDays, dailyDays
+}
+
+// Returns all hourly aggregates for the given devices
+func GetHourlyHistory(ctx context.Context, database *database.Database, ids []string, date time.Time) (map[string][]models.HistoryAggregate, error) {
+	return getAggregates(ctx, database, "history_hourly", ids, date)
+}
+
+// Returns all daily aggregates for the given devices
+func GetDailyHistory(ctx context.Context, database *database.Database, ids []string, date time.Time) (map[string][]models.HistoryAggregate, error) {
+	return getAggregates(ctx, database, "history_daily", ids, date)
+}
+
+// Returns all aggregates of the table newer than the date for the given devices, or all devices if none given
+func getAggregates(ctx context.Context, database *database.Database, table string, ids []string, date time.Time) (map[string][]models.HistoryAggregate, error) {
+	filter := "WHERE period >= ?"
+	args := []interface{}{date.UTC().Format(helper.SqlDateFormat)}
+	if len(ids) > 0 {
+		filter += " AND id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	rows, _err := database.DB.QueryContext(ctx, "SELECT id, period, level, min_level, max_level, samples, loggedin_user, status FROM "+table+" "+filter+" ORDER BY period DESC", args...)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	aggregates := map[string][]models.HistoryAggregate{}
+	for rows.Next() {
+		aggregate := models.HistoryAggregate{}
+		var period mysql.NullTime
+		err := rows.Scan(&aggregate.Id, &period, &aggregate.Level, &aggregate.MinLevel, &aggregate.MaxLevel, &aggregate.Samples, &aggregate.LoggedinUser, &aggregate.Status)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		if period.Valid {
+			aggregate.Period = period.Time
+		}
+		aggregates[aggregate.Id] = append(aggregates[aggregate.Id], aggregate)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return aggregates, nil
+}
@@ -2,7 +2,10 @@ package history
 
 import "time"
 
+// Request selects the history of devices from the date until before the optional end,
+// both are compared as UTC instants like all stored timestamps
 type Request struct {
 	Ids  []string  `json:"ids"`
 	Date time.Time `json:"date"`
+	To   time.Time `json:"to"`
 }
@@ -1,6 +1,7 @@
 package history
 
 import (
+	"context"
 	"fmt"
 	"github.com/viktoriaschule/management-server/charging"
 	"strings"
@@ -14,9 +15,6 @@ import (
 	"github.com/viktoriaschule/management-server/models"
 )
 
-// The max duration to store device changes (30d)
-const maxStoreDuration = time.Hour * 24 * 30
-
 // All the charging management
 var changedSqlHistoryEntries []string
 
@@ -24,18 +22,18 @@ var changedSqlHistoryEntries []string
 var oldHistoryEntries map[string][]models.HistoryEntry
 
 // Prepares the device history synchronization
-func StartSync(database *database.Database) {
+func StartSync(ctx context.Context, database *database.Database) {
 	changedSqlHistoryEntries = []string{}
 
 	// Load all old entries
 	var err error
-	oldHistoryEntries, err = getHistoryEntriesForDevicesAndTime(database, nil, nil)
+	oldHistoryEntries, err = getHistoryEntriesForDevicesAndTime(ctx, database, nil, nil, nil)
 
 	if err != nil {
 		log.Warnf("Error during fetching old history entries: %v", err)
 	}
 
-	charging.StartSync(database, getHistoryEntriesInDuration)
+	charging.StartSync(ctx, database, getHistoryEntriesInDuration)
 }
 
 // Adds a device state to the history
@@ -59,11 +57,10 @@ func SyncDevice(device *models.GeneralDevice, oldDevice *models.GeneralDevice, i
 	changedSqlHistoryEntries = append(changedSqlHistoryEntries, getSqlHistoryEntry(device))
 }
 
-// Synchronizes all previous synced devices to the database
-// and removes all the too old values
-func EndSync(database *database.Database) {
-	addHistoryEntries(database, &changedSqlHistoryEntries)
-	removeOldHistoryEntries(database)
+// Synchronizes all previous synced devices to the database and returns the number of written entries,
+// the too old values are compacted by the compaction job
+func EndSync(ctx context.Context, database *database.Database) (int, error) {
+	return addHistoryEntries(ctx, database, &changedSqlHistoryEntries)
 }
 
 // Returns an sql batter entry value
@@ -81,91 +78,138 @@ func getSqlHistoryEntry(device *models.GeneralDevice) string {
 }
 
 // Adds the given sql history values to the database
-func addHistoryEntries(database *database.Database, entries *[]string) {
+func addHistoryEntries(ctx context.Context, database *database.Database, entries *[]string) (int, error) {
 
 	if len(*entries) > 0 {
 		log.Infof("Add %d history entries...", len(*entries))
 
-		_, err := database.DB.Exec("INSERT INTO history VALUES " + strings.Join(*entries, ", "))
+		_, err := database.DB.ExecContext(ctx, "INSERT INTO history VALUES "+strings.Join(*entries, ", "))
 
 		if err != nil {
 			log.Warnf("Error during adding a new history entry: %v", err)
+			return 0, err
 		}
 
 		log.Debugf("Added history entries...")
 	} else {
 		log.Debugf("Add 0 history entries...")
 	}
+	return len(*entries), nil
 }
 
-// Removes all history entries older than the max store duration
-func removeOldHistoryEntries(database *database.Database) {
-	oldestDate := time.Now().Add(-maxStoreDuration).Format(helper.SqlDateFormat)
-	log.Debugf("Remove history entries older than %s...", oldestDate)
-	_, err := database.DB.Exec("DELETE FROM history WHERE timestamp < ?", oldestDate)
+// Returns all battery entries in the last max loading duration sorted by the date
+func getHistoryEntriesInDuration(ctx context.Context, database *database.Database, duration time.Duration) (entries map[string][]models.HistoryEntry, err error) {
+	oldestDate := time.Now().UTC().Add(duration).Format(helper.SqlDateFormat)
+	return getHistoryEntriesForDevicesAndTime(ctx, database, nil, &oldestDate, nil)
+}
 
-	if err != nil {
-		log.Warnf("Error deleting old battery level entries: %v", err)
-	}
+// Returns all battery entries for the given devices
+func GetHistoryEntriesForDevices(ctx context.Context, database *database.Database, ids []string, date time.Time) (entries map[string][]models.HistoryEntry, err error) {
+	oldestDate := date.UTC().Format(helper.SqlDateFormat)
+	return getHistoryEntriesForDevicesAndTime(ctx, database, &ids, &oldestDate, nil)
+}
 
-	log.Debugf("Removed old devices...")
+// Returns all battery entries for the given devices from the first date until before the second date
+func GetHistoryEntriesForDevicesInRange(ctx context.Context, database *database.Database, ids []string, from time.Time, to time.Time) (entries map[string][]models.HistoryEntry, err error) {
+	oldestDate := from.UTC().Format(helper.SqlDateFormat)
+	newestDate := to.UTC().Format(helper.SqlDateFormat)
+	return getHistoryEntriesForDevicesAndTime(ctx, database, &ids, &oldestDate, &newestDate)
 }
 
-// Returns all battery entries in the last max loading duration sorted by the date
-func getHistoryEntriesInDuration(database *database.Database, duration time.Duration) (entries map[string][]models.HistoryEntry, err error) {
-	oldestDate := time.Now().Add(duration).Format(helper.SqlDateFormat)
-	return getHistoryEntriesForDevicesAndTime(database, nil, &oldestDate)
+// GetHistoryEntriesInPeriod returns all battery entries of all devices from the start until before the end
+// sorted from the newest to the oldest, so consecutive periods do not share the entries at their borders
+func GetHistoryEntriesInPeriod(ctx context.Context, database *database.Database, from time.Time, to time.Time) (map[string][]models.HistoryEntry, error) {
+	entries := map[string][]models.HistoryEntry{}
+	err := IterateHistoryEntries(ctx, database, nil, from, to, func(entry *models.HistoryEntry) error {
+		entries[entry.Id] = append(entries[entry.Id], *entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, deviceEntries := range entries {
+		for i, j := 0, len(deviceEntries)-1; i < j; i, j = i+1, j-1 {
+			deviceEntries[i], deviceEntries[j] = deviceEntries[j], deviceEntries[i]
+		}
+	}
+	return entries, nil
 }
 
-// Returns all battery entries for the given devices
-func GetHistoryEntriesForDevices(database *database.Database, ids []string, date time.Time) (entries map[string][]models.HistoryEntry, err error) {
-	oldestDate := date.Format(helper.SqlDateFormat)
-	return getHistoryEntriesForDevicesAndTime(database, &ids, &oldestDate)
+// IterateHistoryEntries calls the handler for all entries of the given devices, or all devices if none given,
+// from the first date until before the second date sorted by the device and the date, without loading all entries into the memory
+func IterateHistoryEntries(ctx context.Context, database *database.Database, ids []string, from time.Time, to time.Time, handler func(entry *models.HistoryEntry) error) error {
+	filter := "WHERE timestamp >= ?"
+	args := []interface{}{from.UTC().Format(helper.SqlDateFormat)}
+	if !to.IsZero() {
+		filter += " AND timestamp < ?"
+		args = append(args, to.UTC().Format(helper.SqlDateFormat))
+	}
+	if len(ids) > 0 {
+		filter += " AND id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	rows, _err := database.DB.QueryContext(ctx, "SELECT * FROM history "+filter+" ORDER BY id, timestamp", args...)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+	entry := &models.HistoryEntry{}
+	for rows.Next() {
+		var timestamp mysql.NullTime
+		var modified mysql.NullTime
+		err := rows.Scan(&entry.Id, &entry.Level, &entry.LoggedinUser, &entry.Status, &modified, &timestamp)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return &helper.LoadError{Msg: "Database query failed"}
+		}
+		entry.Timestamp = timestamp.Time
+		entry.Modified = modified.Time
+		if err := handler(entry); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return &helper.LoadError{Msg: "Database query failed"}
+	}
+	return nil
 }
 
 // Returns all battery entries in the last max loading duration and with the given ids sorted by the date
-func getHistoryEntriesForDevicesAndTime(database *database.Database, ids *[]string, oldestDate *string) (entries map[string][]models.HistoryEntry, err error) {
-	// Only entries newer than oldest date, if set
-	timeFilter := ""
+func getHistoryEntriesForDevicesAndTime(ctx context.Context, database *database.Database, ids *[]string, oldestDate *string, newestDate *string) (entries map[string][]models.HistoryEntry, err error) {
+	// Only entries newer than oldest date and older than the newest date, if set
+	var conditions []string
+	var args []interface{}
 	if oldestDate != nil {
-		timeFilter = "timestamp >= \"" + *oldestDate + "\""
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, *oldestDate)
+	}
+	if newestDate != nil {
+		conditions = append(conditions, "timestamp < ?")
+		args = append(args, *newestDate)
 	}
 
 	// Filter for all given ids, or when no given, return all
-	idFilter := ""
 	if ids != nil && len(*ids) > 0 {
-		idsCount := len(*ids)
-		idFilter += "("
-		for i, id := range *ids {
-			idFilter += "id = \"" + id + "\""
-			if i != idsCount-1 {
-				idFilter += "OR "
-			}
+		conditions = append(conditions, "id IN (?"+strings.Repeat(", ?", len(*ids)-1)+")")
+		for _, id := range *ids {
+			args = append(args, id)
 		}
-		idFilter += ")"
 	}
 
 	filter := ""
-	if len(timeFilter) > 0 || len(idFilter) > 0 {
-		filter += "WHERE "
-
-		if len(timeFilter) > 0 {
-			filter += timeFilter
-
-			if len(idFilter) > 0 {
-				filter += " AND "
-			}
-		}
-
-		if len(idFilter) > 0 {
-			filter += idFilter
-		}
-		filter += " "
+	if len(conditions) > 0 {
+		filter = "WHERE " + strings.Join(conditions, " AND ") + " "
 	}
 
-	rows, _err := database.DB.Query("SELECT * FROM history " + filter + "ORDER BY timestamp DESC")
+	rows, _err := database.DB.QueryContext(ctx, "SELECT * FROM history "+filter+"ORDER BY timestamp DESC", args...)
 	if _err != nil {
-		log.Errorf("Database query failed: ", _err)
+		log.Errorf("Database query failed: %v", _err)
 		err = &helper.LoadError{Msg: fmt.Sprintf("Database query failed")}
 		return nil, err
 	}
@@ -181,7 +225,7 @@ func getHistoryEntriesForDevicesAndTime(database *database.Database, ids *[]stri
 		var modified mysql.NullTime
 		err := rows.Scan(&entry.Id, &entry.Level, &entry.LoggedinUser, &entry.Status, &modified, &timestamp)
 		if err != nil {
-			log.Errorf("Database query failed: ", err)
+			log.Errorf("Database query failed: %v", err)
 			err = &helper.LoadError{Msg: "Database query failed"}
 			return nil, err
 		}
@@ -208,7 +252,7 @@ func getHistoryEntriesForDevicesAndTime(database *database.Database, ids *[]stri
 	}
 	err = rows.Err()
 	if err != nil {
-		log.Errorf("Database query failed: ", err)
+		log.Errorf("Database query failed: %v", err)
 		err = &helper.LoadError{Msg: "Database query failed"}
 		return nil, err
 	}
@@ -1,8 +1,16 @@
 package history
 
 import (
+	"context"
+	"reflect"
+	"time"
+
 	"github.com/gin-gonic/gin"
+
 	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/export"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
 )
 
 func Serve(root *gin.RouterGroup, database *database.Database) {
@@ -10,7 +18,16 @@ func Serve(root *gin.RouterGroup, database *database.Database) {
 		request := Request{}
 
 		if err := c.ShouldBindJSON(&request); err == nil {
-			entries, err := GetHistoryEntriesForDevices(database, request.Ids, request.Date)
+			if format := export.GetFormat(c); format != "" {
+				exportHistory(c, database, request, format)
+				return
+			}
+			var entries map[string][]models.HistoryEntry
+			if request.To.IsZero() {
+				entries, err = GetHistoryEntriesForDevices(c.Request.Context(), database, request.Ids, request.Date)
+			} else {
+				entries, err = GetHistoryEntriesForDevicesInRange(c.Request.Context(), database, request.Ids, request.Date, request.To)
+			}
 			if err != nil {
 				c.JSON(500, gin.H{"error": err.Error()})
 				return
@@ -20,4 +37,58 @@ func Serve(root *gin.RouterGroup, database *database.Database) {
 		}
 		c.JSON(400, gin.H{"error": "Wrong body format"})
 	})
+
+	root.POST("/history/hourly", func(c *gin.Context) {
+		serveAggregates(c, database, GetHourlyHistory)
+	})
+
+	root.POST("/history/daily", func(c *gin.Context) {
+		serveAggregates(c, database, GetDailyHistory)
+	})
+}
+
+// Streams all history entries of the request as the export format
+func exportHistory(c *gin.Context, database *database.Database, request Request, format string) {
+	writer, ok := export.StartResponse(c, "history", format)
+	if !ok {
+		return
+	}
+	if err := ExportHistory(c.Request.Context(), database, request, writer); err != nil {
+		log.Warnf("Error exporting history: %v", err)
+	}
+}
+
+// ExportHistory writes all history entries of the request to the export writer and closes it
+func ExportHistory(ctx context.Context, database *database.Database, request Request, writer export.Writer) error {
+	table := export.NewTableWriter(writer, reflect.TypeOf(models.HistoryEntry{}))
+	err := IterateHistoryEntries(ctx, database, request.Ids, request.Date, request.To, func(entry *models.HistoryEntry) error {
+		return table.Write(entry)
+	})
+	if err != nil {
+		return err
+	}
+	return table.Close()
+}
+
+func serveAggregates(c *gin.Context, database *database.Database, getAggregates func(context.Context, *database.Database, []string, time.Time) (map[string][]models.HistoryAggregate, error)) {
+	request := Request{}
+
+	if err := c.ShouldBindJSON(&request); err == nil {
+		aggregates, err := getAggregates(c.Request.Context(), database, request.Ids, request.Date)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if export.GetFormat(c) != "" {
+			list := []models.HistoryAggregate{}
+			for _, deviceAggregates := range aggregates {
+				list = append(list, deviceAggregates...)
+			}
+			export.Respond(c, "history", list)
+			return
+		}
+		c.JSON(200, gin.H{"devices": aggregates})
+		return
+	}
+	c.JSON(400, gin.H{"error": "Wrong body format"})
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/viktoriaschule/management-server/audit"
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/history"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/relution"
+	"github.com/viktoriaschule/management-server/schedule"
+	"github.com/viktoriaschule/management-server/scheduler"
+	"github.com/viktoriaschule/management-server/usage"
+)
+
+// The names of the scheduled jobs, which are used as keys in the jobs config
+const (
+	syncJob       = relution.SyncJob
+	compactionJob = "history_compaction"
+	rollupsJob    = "usage_rollups"
+	auditJob      = "audit_cleanup"
+)
+
+// The intervals of the jobs without a configured schedule
+var defaultIntervals = map[string]time.Duration{
+	syncJob:       relution.DefaultSyncInterval,
+	compactionJob: time.Hour,
+	rollupsJob:    time.Hour,
+	auditJob:      time.Hour,
+}
+
+// Registers all jobs with their configured schedules, each run uses the current config
+func scheduleJobs(s *scheduler.Scheduler, getConfig func() *config.Config, db *database.Database, r *relution.Relution) {
+	c := getConfig()
+	addJob(s, c, syncJob, r.FetchDevices)
+	addJob(s, c, compactionJob, func(ctx context.Context) error {
+		return history.Compact(ctx, db, getConfig())
+	})
+	addJob(s, c, rollupsJob, func(ctx context.Context) error {
+		return usage.ComputeRollups(ctx, db)
+	})
+	addJob(s, c, auditJob, func(ctx context.Context) error {
+		return audit.RemoveOldEntries(ctx, db, getConfig())
+	})
+}
+
+// Applies changed schedules of the config to the registered jobs
+func rescheduleJobs(s *scheduler.Scheduler, c *config.Config) {
+	for name, defaultInterval := range defaultIntervals {
+		jobConfig := c.Jobs[name]
+		jobSchedule, err := schedule.Parse(jobConfig.Interval, jobConfig.Cron, defaultInterval)
+		if err != nil {
+			log.Warnf("Invalid schedule of job %s: %v", name, err)
+			continue
+		}
+		if err = s.SetSchedule(name, jobSchedule, jobConfig.Jitter); err != nil {
+			log.Warnf("Cannot reschedule job %s: %v", name, err)
+		}
+	}
+}
+
+func addJob(s *scheduler.Scheduler, c *config.Config, name string, job scheduler.Job) {
+	jobConfig := c.Jobs[name]
+	jobSchedule, err := schedule.Parse(jobConfig.Interval, jobConfig.Cron, defaultIntervals[name])
+	if err != nil {
+		log.Errorf("Invalid schedule of job %s: %v", name, err)
+		os.Exit(1)
+	}
+	s.Add(name, jobSchedule, jobConfig.Jitter, job)
+}
@@ -0,0 +1,32 @@
+package lending
+
+import "time"
+
+// The types of borrowers a device can be assigned to
+const (
+	studentBorrower = "student"
+	classBorrower   = "class"
+)
+
+type CheckoutRequest struct {
+	DeviceId     string     `json:"device_id" binding:"required"`
+	Borrower     string     `json:"borrower" binding:"required"`
+	BorrowerType string     `json:"borrower_type" binding:"required"`
+	Due          *time.Time `json:"due"`
+	Note         string     `json:"note"`
+}
+
+type CheckinRequest struct {
+	DeviceId string `json:"device_id" binding:"required"`
+}
+
+type Filter struct {
+	DeviceId string    `form:"device"`
+	Borrower string    `form:"borrower"`
+	From     time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To       time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+type UsageRequest struct {
+	Id int64 `form:"id" binding:"required"`
+}
@@ -0,0 +1,243 @@
+package lending
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/history"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+// The error returned when a device is already lent
+var ErrAlreadyLent = errors.New("Device is already lent")
+
+// The error returned when a device is not lent
+var ErrNotLent = errors.New("Device is not lent")
+
+// The error returned when the device is not known
+var ErrUnknownDevice = errors.New("Unknown device")
+
+// The error returned when the borrower is neither a student nor a class
+var ErrUnknownBorrowerType = errors.New("Unknown borrower type, expected student or class")
+
+// The error number of mysql for a duplicate entry of a unique key
+const duplicateEntry = 1062
+
+// Checkout assigns the device to the borrower until the device is checked in again
+func Checkout(ctx context.Context, database *database.Database, request CheckoutRequest, issuedBy string) (*models.Lending, error) {
+	if request.BorrowerType != studentBorrower && request.BorrowerType != classBorrower {
+		return nil, ErrUnknownBorrowerType
+	}
+
+	lending := &models.Lending{
+		DeviceId:     request.DeviceId,
+		Borrower:     request.Borrower,
+		BorrowerType: request.BorrowerType,
+		IssuedBy:     issuedBy,
+		CheckedOut:   time.Now(),
+		Due:          request.Due,
+		Note:         request.Note,
+	}
+	var due interface{}
+	if lending.Due != nil {
+		due = lending.Due.UTC().Format(helper.SqlDateFormat)
+	}
+
+	var exists int
+	err := database.DB.QueryRowContext(ctx, "SELECT 1 FROM devices WHERE id = ?", request.DeviceId).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return nil, ErrUnknownDevice
+	} else if err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	// The unique key on the open device id allows only one open lending per device,
+	// so concurrent checkouts of the same device cannot both succeed
+	result, err := database.DB.ExecContext(ctx,
+		"INSERT INTO lendings (device_id, borrower, borrower_type, issued_by, checked_out, due, note) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		lending.DeviceId,
+		lending.Borrower,
+		lending.BorrowerType,
+		lending.IssuedBy,
+		lending.CheckedOut.UTC().Format(helper.SqlDateFormat),
+		due,
+		lending.Note,
+	)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == duplicateEntry {
+		return nil, ErrAlreadyLent
+	} else if err != nil {
+		log.Errorf("Error adding lending: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	lending.Id, _ = result.LastInsertId()
+	return lending, nil
+}
+
+// Checkin marks the open lending of the device as returned
+func Checkin(ctx context.Context, database *database.Database, deviceId string, returnedTo string) (*models.Lending, error) {
+	open, err := getLendings(ctx, database, "WHERE device_id = ? AND checked_in IS NULL", deviceId)
+	if err != nil {
+		return nil, err
+	}
+	if len(open) == 0 {
+		return nil, ErrNotLent
+	}
+
+	lending := open[0]
+	now := time.Now()
+	lending.CheckedIn = &now
+	lending.ReturnedTo = returnedTo
+	_, err = database.DB.ExecContext(ctx,
+		"UPDATE lendings SET checked_in = ?, returned_to = ? WHERE id = ?",
+		now.UTC().Format(helper.SqlDateFormat),
+		returnedTo,
+		lending.Id,
+	)
+	if err != nil {
+		log.Errorf("Error updating lending: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return &lending, nil
+}
+
+// GetLendings returns the lending history matching the filter, newest first
+func GetLendings(ctx context.Context, database *database.Database, filter Filter) ([]models.Lending, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.DeviceId != "" {
+		conditions = append(conditions, "device_id = ?")
+		args = append(args, filter.DeviceId)
+	}
+	if filter.Borrower != "" {
+		conditions = append(conditions, "borrower = ?")
+		args = append(args, filter.Borrower)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "(checked_in IS NULL OR checked_in >= ?)")
+		args = append(args, filter.From.UTC().Format(helper.SqlDateFormat))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "checked_out <= ?")
+		args = append(args, filter.To.UTC().Format(helper.SqlDateFormat))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	return getLendings(ctx, database, where, args...)
+}
+
+// GetUnreturnedLendings returns all lendings without a check-in
+func GetUnreturnedLendings(ctx context.Context, database *database.Database) ([]models.Lending, error) {
+	return getLendings(ctx, database, "WHERE checked_in IS NULL")
+}
+
+// GetOverdueLendings returns all unreturned lendings with a due date in the past
+func GetOverdueLendings(ctx context.Context, database *database.Database) ([]models.Lending, error) {
+	lendings, err := getLendings(ctx, database, "WHERE checked_in IS NULL AND due IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	overdue := []models.Lending{}
+	for _, lending := range lendings {
+		if lending.IsOverdue(now) {
+			overdue = append(overdue, lending)
+		}
+	}
+	return overdue, nil
+}
+
+// GetLendingUsage returns the lending with all history entries of the device in the lending period
+// and all users logged in during this period, which are not the borrower
+func GetLendingUsage(ctx context.Context, database *database.Database, id int64) (*models.Lending, []models.HistoryEntry, []string, error) {
+	lendings, err := getLendings(ctx, database, "WHERE id = ?", id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(lendings) == 0 {
+		return nil, nil, nil, sql.ErrNoRows
+	}
+	lending := lendings[0]
+
+	end := time.Now()
+	if lending.CheckedIn != nil {
+		end = *lending.CheckedIn
+	}
+	entries, err := history.GetHistoryEntriesForDevicesInRange(ctx, database, []string{lending.DeviceId}, lending.CheckedOut, end)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Only students can be compared with the logged in user
+	foreignUsers := []string{}
+	if lending.BorrowerType == studentBorrower {
+		seen := map[string]bool{}
+		for _, entry := range entries[lending.DeviceId] {
+			if entry.LoggedinUser != "" && entry.LoggedinUser != lending.Borrower && !seen[entry.LoggedinUser] {
+				seen[entry.LoggedinUser] = true
+				foreignUsers = append(foreignUsers, entry.LoggedinUser)
+			}
+		}
+	}
+
+	return &lending, entries[lending.DeviceId], foreignUsers, nil
+}
+
+// Returns all lendings matching the filter
+func getLendings(ctx context.Context, database *database.Database, filter string, args ...interface{}) ([]models.Lending, error) {
+	rows, _err := database.DB.QueryContext(ctx, "SELECT id, device_id, borrower, borrower_type, issued_by, checked_out, due, checked_in, returned_to, note FROM lendings "+filter+" ORDER BY checked_out DESC", args...)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	lendings := []models.Lending{}
+	for rows.Next() {
+		lending := models.Lending{}
+		var checkedOut, due, checkedIn mysql.NullTime
+		var returnedTo sql.NullString
+		err := rows.Scan(
+			&lending.Id,
+			&lending.DeviceId,
+			&lending.Borrower,
+			&lending.BorrowerType,
+			&lending.IssuedBy,
+			&checkedOut,
+			&due,
+			&checkedIn,
+			&returnedTo,
+			&lending.Note,
+		)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		if checkedOut.Valid {
+			lending.CheckedOut = checkedOut.Time
+		}
+		if due.Valid {
+			lending.Due = &due.Time
+		}
+		if checkedIn.Valid {
+			lending.CheckedIn = &checkedIn.Time
+		}
+		lending.ReturnedTo = returnedTo.String
+		lendings = append(lendings, lending)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return lendings, nil
+}
@@ -0,0 +1,107 @@
+package lending
+
+import (
+	"database/sql"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/viktoriaschule/management-server/audit"
+	"github.com/viktoriaschule/management-server/auth"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/export"
+)
+
+func Serve(staff *gin.RouterGroup, database *database.Database) {
+	staff.POST("/checkout", func(c *gin.Context) {
+		request := CheckoutRequest{}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(400, gin.H{"error": "Wrong body format"})
+			return
+		}
+		user := auth.GetUser(c)
+		lending, err := Checkout(c.Request.Context(), database, request, user.Username)
+		if err == ErrAlreadyLent {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		} else if err == ErrUnknownDevice {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		} else if err == ErrUnknownBorrowerType {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		audit.RecordAction(database, user.Username, "checkout", lending)
+		c.JSON(200, gin.H{"lending": lending})
+	})
+
+	staff.POST("/checkin", func(c *gin.Context) {
+		request := CheckinRequest{}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(400, gin.H{"error": "Wrong body format"})
+			return
+		}
+		user := auth.GetUser(c)
+		lending, err := Checkin(c.Request.Context(), database, request.DeviceId, user.Username)
+		if err == ErrNotLent {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		audit.RecordAction(database, user.Username, "checkin", lending)
+		c.JSON(200, gin.H{"lending": lending})
+	})
+
+	staff.GET("/lendings", func(c *gin.Context) {
+		filter := Filter{}
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(400, gin.H{"error": "Wrong query format"})
+			return
+		}
+		lendings, err := GetLendings(c.Request.Context(), database, filter)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "lendings", lendings)
+	})
+
+	staff.GET("/lendings/unreturned", func(c *gin.Context) {
+		lendings, err := GetUnreturnedLendings(c.Request.Context(), database)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "lendings", lendings)
+	})
+
+	staff.GET("/lendings/overdue", func(c *gin.Context) {
+		lendings, err := GetOverdueLendings(c.Request.Context(), database)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "lendings", lendings)
+	})
+
+	staff.GET("/lendings/usage", func(c *gin.Context) {
+		request := UsageRequest{}
+		if err := c.ShouldBindQuery(&request); err != nil {
+			c.JSON(400, gin.H{"error": "Wrong query format"})
+			return
+		}
+		lending, entries, foreignUsers, err := GetLendingUsage(c.Request.Context(), database, request.Id)
+		if err == sql.ErrNoRows {
+			c.JSON(404, gin.H{"error": "Lending not found"})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"lending": lending, "history": entries, "foreign_users": foreignUsers})
+	})
+}
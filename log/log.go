@@ -1,7 +1,7 @@
 package log
 
 import (
-	"fmt"
+	"strings"
 
 	"github.com/logrusorgru/aurora"
 )
@@ -13,34 +13,47 @@ const (
 	Error = 0
 )
 
+// Level is the global log level, it is guarded by the logger mutex, so it is set with SetLogLevel and read with GetLevel
 var Level = Debug
 
-func SetLogLevel(logLevelName string) {
-	switch logLevelName {
+// ParseLevel returns the level of a level name, unknown names are debug
+func ParseLevel(logLevelName string) int {
+	switch strings.ToLower(logLevelName) {
 	case "debug":
-		Level = Debug
-		break
+		return Debug
 	case "info":
-		Level = Info
-		break
+		return Info
 	case "warn":
-		Level = Warn
-		break
+		return Warn
 	case "error":
-		Level = Error
-		break
+		return Error
 	default:
-		Level = Debug
+		return Debug
 	}
 }
 
+func SetLogLevel(logLevelName string) {
+	std.mutex.Lock()
+	defer std.mutex.Unlock()
+	Level = ParseLevel(logLevelName)
+}
+
+// GetLevel returns the global log level
+func GetLevel() int {
+	std.mutex.Lock()
+	defer std.mutex.Unlock()
+	return Level
+}
+
 // Colorize change the logger to support colors printing.
 func Colorize() {
 	au = aurora.NewAurora(true)
+	colored = true
 }
 
 // internal colorized
 var au aurora.Aurora
+var colored bool
 
 // Au Aurora instance used for colors
 func Au() aurora.Aurora {
@@ -50,46 +63,32 @@ func Au() aurora.Aurora {
 	return au
 }
 
-// Printf print a message with formatting
-func Printf(part string, parts ...interface{}) {
-	if Level >= Debug {
-		managementPrint()
-		fmt.Println(fmt.Sprintf(part, parts...))
-	}
+// Printf print a message with formatting (info level without color)
+func Printf(format string, args ...interface{}) {
+	std.output(Info, 0, nil, format, args...)
 }
 
 // Errorf print a error with formatting (red)
-func Errorf(part string, parts ...interface{}) {
-	if Level >= Error {
-		managementPrint()
-		fmt.Println(Au().Colorize(fmt.Sprintf(fmt.Sprintf("%v", part), parts...), aurora.RedFg).String())
-	}
+func Errorf(format string, args ...interface{}) {
+	std.output(Error, aurora.RedFg, nil, format, args...)
 }
 
 // Warnf print a warning with formatting (yellow)
-func Warnf(part string, parts ...interface{}) {
-	if Level >= Warn {
-		managementPrint()
-		fmt.Println(Au().Colorize(fmt.Sprintf(fmt.Sprintf("%v", part), parts...), aurora.YellowFg).String())
-	}
+func Warnf(format string, args ...interface{}) {
+	std.output(Warn, aurora.YellowFg, nil, format, args...)
 }
 
 // Infof print a information with formatting (green)
-func Infof(part string, parts ...interface{}) {
-	if Level >= Info {
-		managementPrint()
-		fmt.Println(Au().Colorize(fmt.Sprintf(fmt.Sprintf("%v", part), parts...), aurora.GreenFg).String())
-	}
+func Infof(format string, args ...interface{}) {
+	std.output(Info, aurora.GreenFg, nil, format, args...)
 }
 
-// Infof print a information with formatting (green)
-func Debugf(part string, parts ...interface{}) {
-	if Level >= Debug {
-		managementPrint()
-		fmt.Println(Au().Colorize(fmt.Sprintf(fmt.Sprintf("%v", part), parts...), aurora.GreenFg).String())
-	}
+// Debugf print a debug information with formatting (blue)
+func Debugf(format string, args ...interface{}) {
+	std.output(Debug, aurora.BlueFg, nil, format, args...)
 }
 
-func managementPrint() {
-	fmt.Print(Au().Bold(Au().Cyan("management: ")).String())
+// With returns an entry that adds the given key value pairs to every message
+func With(keysAndValues ...interface{}) *Entry {
+	return &Entry{fields: toFields(nil, keysAndValues)}
 }
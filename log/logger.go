@@ -0,0 +1,244 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+)
+
+// The supported log formats
+const (
+	FormatConsole = "console"
+	FormatJson    = "json"
+)
+
+// The time format of all log messages
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+var levelNames = map[int]string{
+	Debug: "debug",
+	Info:  "info",
+	Warn:  "warn",
+	Error: "error",
+}
+
+// Options configure the output of the logger
+type Options struct {
+	// Format is either console or json, the default is console
+	Format string
+	// Output is stdout, stderr or the path of a file, the default is stdout
+	Output string
+	// Packages overrides the log level for single packages by their name (e.g. history: warn)
+	Packages map[string]string
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+type logger struct {
+	mutex    sync.Mutex
+	writer   io.Writer
+	file     *os.File
+	json     bool
+	colors   bool
+	packages map[string]int
+}
+
+var std = &logger{writer: os.Stdout, colors: true}
+
+// Configure applies the options to the logger
+func Configure(options Options) error {
+	std.mutex.Lock()
+	defer std.mutex.Unlock()
+
+	var writer io.Writer
+	var file *os.File
+	switch options.Output {
+	case "", "stdout":
+		writer = os.Stdout
+	case "stderr":
+		writer = os.Stderr
+	default:
+		f, err := os.OpenFile(options.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %v", err)
+		}
+		writer, file = f, f
+	}
+
+	switch options.Format {
+	case "", FormatConsole:
+		std.json = false
+	case FormatJson:
+		std.json = true
+	default:
+		if file != nil {
+			//noinspection GoUnhandledErrorResult
+			file.Close()
+		}
+		return fmt.Errorf("unknown log format %q", options.Format)
+	}
+
+	packages := map[string]int{}
+	for name, level := range options.Packages {
+		packages[name] = ParseLevel(level)
+	}
+
+	if std.file != nil {
+		//noinspection GoUnhandledErrorResult
+		std.file.Close()
+	}
+	std.writer = writer
+	std.file = file
+	// Colors in files are only escape sequences
+	std.colors = file == nil
+	std.packages = packages
+	return nil
+}
+
+// Returns the name of the package of the function that logged the message
+func callerPackage(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return ""
+	}
+	name := runtime.FuncForPC(pc).Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+func (l *logger) output(level int, color aurora.Color, fields []field, format string, args ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// Looking up the caller is only needed for package levels
+	if len(l.packages) == 0 && level > Level {
+		return
+	}
+	pkg := callerPackage(2)
+	maxLevel := Level
+	if packageLevel, ok := l.packages[pkg]; ok {
+		maxLevel = packageLevel
+	}
+	if level > maxLevel {
+		return
+	}
+
+	now := time.Now()
+	message := fmt.Sprintf(format, args...)
+	if l.json {
+		l.writeJson(now, level, pkg, message, fields)
+	} else {
+		l.writeConsole(now, level, color, message, fields)
+	}
+}
+
+func (l *logger) writeJson(now time.Time, level int, pkg, message string, fields []field) {
+	values := map[string]interface{}{}
+	for _, f := range fields {
+		if err, ok := f.value.(error); ok {
+			values[f.key] = err.Error()
+		} else {
+			values[f.key] = f.value
+		}
+	}
+	values["time"] = now.Format(timeFormat)
+	values["level"] = levelNames[level]
+	values["package"] = pkg
+	values["msg"] = message
+
+	bytes, err := json.Marshal(values)
+	if err != nil {
+		bytes, _ = json.Marshal(map[string]string{
+			"time":  values["time"].(string),
+			"level": levelNames[Error],
+			"msg":   fmt.Sprintf("Failed to encode log message: %v", err),
+		})
+	}
+	//noinspection GoUnhandledErrorResult
+	l.writer.Write(append(bytes, '\n'))
+}
+
+func (l *logger) writeConsole(now time.Time, level int, color aurora.Color, message string, fields []field) {
+	a := aurora.NewAurora(l.colors && colored)
+
+	var builder strings.Builder
+	builder.WriteString(a.Faint(now.Format(timeFormat)).String())
+	builder.WriteString(" ")
+	builder.WriteString(a.Colorize(fmt.Sprintf("%-5s", strings.ToUpper(levelNames[level])), color).String())
+	builder.WriteString(" ")
+	builder.WriteString(a.Bold(a.Cyan("management: ")).String())
+	builder.WriteString(a.Colorize(message, color).String())
+	for _, f := range fields {
+		builder.WriteString(" ")
+		builder.WriteString(a.Cyan(f.key + "=").String())
+		builder.WriteString(fmt.Sprintf("%v", f.value))
+	}
+	builder.WriteString("\n")
+	//noinspection GoUnhandledErrorResult
+	io.WriteString(l.writer, builder.String())
+}
+
+// Converts key value pairs to fields and appends them to the given fields
+func toFields(fields []field, keysAndValues []interface{}) []field {
+	result := make([]field, len(fields), len(fields)+len(keysAndValues)/2)
+	copy(result, fields)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprintf("%v", keysAndValues[i])
+		var value interface{} = "MISSING"
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		result = append(result, field{key: key, value: value})
+	}
+	return result
+}
+
+// Entry is a logger with key value fields that are added to every message
+type Entry struct {
+	fields []field
+}
+
+// With returns an entry with the additional key value pairs
+func (e *Entry) With(keysAndValues ...interface{}) *Entry {
+	return &Entry{fields: toFields(e.fields, keysAndValues)}
+}
+
+// Printf print a message with formatting and the fields of the entry (info level without color)
+func (e *Entry) Printf(format string, args ...interface{}) {
+	std.output(Info, 0, e.fields, format, args...)
+}
+
+// Errorf print a error with formatting and the fields of the entry (red)
+func (e *Entry) Errorf(format string, args ...interface{}) {
+	std.output(Error, aurora.RedFg, e.fields, format, args...)
+}
+
+// Warnf print a warning with formatting and the fields of the entry (yellow)
+func (e *Entry) Warnf(format string, args ...interface{}) {
+	std.output(Warn, aurora.YellowFg, e.fields, format, args...)
+}
+
+// Infof print a information with formatting and the fields of the entry (green)
+func (e *Entry) Infof(format string, args ...interface{}) {
+	std.output(Info, aurora.GreenFg, e.fields, format, args...)
+}
+
+// Debugf print a debug information with formatting and the fields of the entry (blue)
+func (e *Entry) Debugf(format string, args ...interface{}) {
+	std.output(Debug, aurora.BlueFg, e.fields, format, args...)
+}
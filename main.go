@@ -1,61 +1,194 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/viktoriaschule/management-server/config"
 	"github.com/viktoriaschule/management-server/database"
-	"github.com/viktoriaschule/management-server/helper"
 	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
 	"github.com/viktoriaschule/management-server/relution"
 	"github.com/viktoriaschule/management-server/rest"
+	"github.com/viktoriaschule/management-server/scheduler"
 )
 
+// The default duration to drain requests and jobs on shutdown (30s)
+const defaultShutdownTimeout = time.Second * 30
+
 var (
-	colors bool
+	colors     bool
+	configPath string
+	settings   []string
+	port       int
+	logLevel   string
 )
 
 func init() {
 	rootCmd.PersistentFlags().BoolVar(&colors, "colors", true, "Add colors to log")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "config.yaml", "Path of the config file")
+	rootCmd.PersistentFlags().StringArrayVar(&settings, "set", nil, "Override a setting by its path (e.g. mysql.host=localhost)")
+	rootCmd.PersistentFlags().IntVar(&port, "port", 0, "Port of the API")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "", "Log level (debug, info, warn or error)")
 }
 
 func initManagementServer() {
 	if colors {
 		log.Colorize()
 	}
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		for range c {
-			fmt.Println("")
-			os.Exit(1)
-		}
-	}()
 }
 
 var rootCmd = &cobra.Command{
 	Use:   "management-server",
 	Short: "Backend for the management system",
 	Run: func(cmd *cobra.Command, args []string) {
-		c := config.GetConfig()
-
-		log.SetLogLevel(c.LogLevel)
+		options := configOptions(cmd)
+		c := loadConfig(options)
+		configureLogging(c)
+		models.SetNamingRules(c.NamingRules())
 
 		db := database.NewDatabase(c)
 		db.CreateTables()
 
-		r := relution.NewRelution(c, db)
-		helper.Schedule(r.FetchDevices, time.Minute)
+		// All later readers get the current config from the reloader
+		reloader := config.NewReloader(c, options)
+		r := relution.NewRelution(reloader.Config, db)
+		s := scheduler.NewScheduler()
+		scheduleJobs(s, reloader.Config, db, r)
+
+		reloader.OnReload(func(c *config.Config) {
+			if err := applyLogging(c); err != nil {
+				log.Warnf("Cannot apply log config: %v", err)
+			}
+			models.SetNamingRules(c.NamingRules())
+			rescheduleJobs(s, c)
+		})
 
-		rest.Serve(c, db)
+		server := rest.NewServer(db, s, reloader)
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Errorf("Error serving API: %v", err)
+				os.Exit(1)
+			}
+		}()
+
+		waitForShutdown(reloader)
+		shutdown(reloader.Config(), db, server, s)
 	},
 }
 
+// Reloads the config on SIGHUP until SIGINT or SIGTERM is received
+func waitForShutdown(reloader *config.Reloader) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			log.Infof("Received %v, shutting down...", sig)
+			return
+		}
+		log.Infof("Received %v, reloading config...", sig)
+		result, err := reloader.Reload()
+		if err != nil {
+			logConfigError("Invalid config, keeping the current config:", err)
+			continue
+		}
+		log.Infof("Reloaded config, applied: %v, requires a restart: %v", result.Applied, result.RestartRequired)
+	}
+}
+
+// Stops accepting requests and drains the running requests and jobs,
+// jobs that exceed the shutdown timeout are canceled
+func shutdown(c *config.Config, db *database.Database, server *rest.Server, s *scheduler.Scheduler) {
+	timeout := c.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Warnf("Failed to drain requests: %v", err)
+	}
+	s.Stop(ctx)
+
+	if err := db.DB.Close(); err != nil {
+		log.Warnf("Failed to close database: %v", err)
+	}
+	log.Infof("Stopped")
+}
+
+// Returns the config sources selected by the flags
+func configOptions(cmd *cobra.Command) config.Options {
+	overrides := map[string]string{}
+	for _, setting := range settings {
+		pair := strings.SplitN(setting, "=", 2)
+		if len(pair) != 2 {
+			log.Errorf("Invalid setting %q, expected path=value", setting)
+			os.Exit(1)
+		}
+		overrides[pair[0]] = pair[1]
+	}
+	if cmd.Flags().Changed("port") {
+		overrides["port"] = strconv.Itoa(port)
+	}
+	if cmd.Flags().Changed("log-level") {
+		overrides["loglevel"] = logLevel
+	}
+	return config.Options{
+		Path:      configPath,
+		Optional:  !cmd.Flags().Changed("config"),
+		Overrides: overrides,
+	}
+}
+
+// Loads the config and exits on invalid configs
+func loadConfig(options config.Options) *config.Config {
+	c, err := config.Load(options)
+	if err != nil {
+		logConfigError("Invalid config, refusing to start:", err)
+		os.Exit(1)
+	}
+	return c
+}
+
+// Logs all problems of an invalid config
+func logConfigError(message string, err error) {
+	validationError, ok := err.(*config.ValidationError)
+	if !ok {
+		log.Errorf("Failed to load config: %v", err)
+		return
+	}
+	log.Errorf(message)
+	for _, problem := range validationError.Problems {
+		log.Errorf("  %s", problem)
+	}
+}
+
+// Applies the log settings of the config and exits on invalid settings
+func configureLogging(c *config.Config) {
+	if err := applyLogging(c); err != nil {
+		log.Errorf("Invalid log config: %v", err)
+		os.Exit(1)
+	}
+}
+
+func applyLogging(c *config.Config) error {
+	log.SetLogLevel(c.LogLevel)
+	return log.Configure(log.Options{
+		Format:   c.Log.Format,
+		Output:   c.Log.Output,
+		Packages: c.Log.Packages,
+	})
+}
+
 func main() {
 	cobra.OnInitialize(initManagementServer)
 	if err := rootCmd.Execute(); err != nil {
@@ -0,0 +1,16 @@
+package metrics
+
+// The buckets for request and sync durations in seconds
+var durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// The buckets for battery levels in percent
+var batteryBuckets = []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
+
+// The metrics recorded by the other packages
+var (
+	SyncDuration     = NewHistogram("management_sync_duration_seconds", "Duration of the Relution device syncs", durationBuckets)
+	Syncs            = NewCounter("management_syncs_total", "Count of Relution device syncs by result", "result")
+	RelutionDuration = NewHistogram("management_relution_request_duration_seconds", "Response time of the Relution API", durationBuckets)
+	LdapDuration     = NewHistogram("management_ldap_request_duration_seconds", "Response time of the LDAP authentication API", durationBuckets)
+	LdapFailures     = NewCounter("management_ldap_failures_total", "Count of failed LDAP authentications by reason", "reason")
+)
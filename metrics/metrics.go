@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// All registered counters and histograms, written in the order of registration
+var registered []collector
+
+type collector interface {
+	write(w io.Writer)
+}
+
+// Counter is a monotonically increasing value per label combination
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+	mutex  sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter registers a new counter with the given label names
+func NewCounter(name string, help string, labels ...string) *Counter {
+	counter := &Counter{name: name, help: help, labels: labels, values: map[string]float64{}}
+	registered = append(registered, counter)
+	return counter
+}
+
+// Inc increments the counter of the given label values by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.values[strings.Join(labelValues, "\x00")]++
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	writeHeader(w, c.name, c.help, "counter")
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		labels := map[string]string{}
+		for i, value := range strings.Split(key, "\x00") {
+			if i < len(c.labels) {
+				labels[c.labels[i]] = value
+			}
+		}
+		writeSample(w, c.name, labels, c.values[key])
+	}
+}
+
+// Histogram counts observed values in cumulative buckets
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	mutex   sync.Mutex
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram registers a new histogram with the given upper bucket bounds
+func NewHistogram(name string, help string, buckets []float64) *Histogram {
+	histogram := newHistogram(name, help, buckets)
+	registered = append(registered, histogram)
+	return histogram
+}
+
+func newHistogram(name string, help string, buckets []float64) *Histogram {
+	return &Histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// Observe adds the value to the histogram
+func (h *Histogram) Observe(value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// ObserveSince adds the seconds since the start to the histogram
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	for i, bound := range h.buckets {
+		writeSample(w, h.name+"_bucket", map[string]string{"le": formatFloat(bound)}, float64(h.counts[i]))
+	}
+	writeSample(w, h.name+"_bucket", map[string]string{"le": "+Inf"}, float64(h.count))
+	writeSample(w, h.name+"_sum", nil, h.sum)
+	writeSample(w, h.name+"_count", nil, float64(h.count))
+}
+
+// GaugeWriter writes gauges computed at the time of the scrape
+type GaugeWriter struct {
+	w io.Writer
+}
+
+// Gauge writes a gauge with one value
+func (g *GaugeWriter) Gauge(name string, help string, value float64) {
+	writeHeader(g.w, name, help, "gauge")
+	writeSample(g.w, name, nil, value)
+}
+
+// GaugeVec writes a gauge with one value per value of the label
+func (g *GaugeWriter) GaugeVec(name string, help string, label string, values map[string]float64) {
+	writeHeader(g.w, name, help, "gauge")
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeSample(g.w, name, map[string]string{label: key}, values[key])
+	}
+}
+
+// Histogram writes a histogram of the given values
+func (g *GaugeWriter) Histogram(name string, help string, buckets []float64, values []float64) {
+	histogram := newHistogram(name, help, buckets)
+	for _, value := range values {
+		histogram.Observe(value)
+	}
+	histogram.write(g.w)
+}
+
+// Write writes all registered metrics and the metrics of the scrape time collectors
+// in the Prometheus text format
+func Write(w io.Writer, collectors ...func(g *GaugeWriter)) error {
+	buffer := bufio.NewWriter(w)
+	for _, c := range registered {
+		c.write(buffer)
+	}
+	gauges := &GaugeWriter{w: buffer}
+	for _, collect := range collectors {
+		collect(gauges)
+	}
+	return buffer.Flush()
+}
+
+// Escapes the backslashes and line breaks of help texts like the Prometheus text format
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// Escapes the backslashes, quotes and line breaks of label values like the Prometheus text format,
+// all other characters including non ASCII characters are written as they are
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeHeader(w io.Writer, name string, help string, metricType string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, helpEscaper.Replace(help), name, metricType)
+}
+
+func writeSample(w io.Writer, name string, labels map[string]string, value float64) {
+	if len(labels) == 0 {
+		_, _ = fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+		return
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, key, labelValueEscaper.Replace(labels[key]))
+	}
+	_, _ = fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(value))
+}
+
+func formatFloat(value float64) string {
+	return strings.TrimSuffix(fmt.Sprintf("%g", value), ".0")
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+func Serve(r gin.IRoutes, database *database.Database, getDevices func(context.Context, *database.Database) (*[]models.GeneralDevice, error)) {
+	r.GET("/metrics", func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4")
+		c.Status(200)
+		err := Write(c.Writer, func(g *GaugeWriter) {
+			writeDeviceMetrics(c.Request.Context(), g, database, getDevices)
+		}, func(g *GaugeWriter) {
+			writeDatabaseMetrics(g, database)
+		})
+		if err != nil {
+			log.Warnf("Error writing metrics: %v", err)
+		}
+	})
+}
+
+// Writes the device counts and battery levels of the current devices
+func writeDeviceMetrics(ctx context.Context, g *GaugeWriter, database *database.Database, getDevices func(context.Context, *database.Database) (*[]models.GeneralDevice, error)) {
+	devices, err := getDevices(ctx, database)
+	if err != nil {
+		log.Warnf("Error loading devices for metrics: %v", err)
+		return
+	}
+	statuses := map[string]float64{}
+	groups := map[string]float64{}
+	var charging float64
+	levels := make([]float64, 0, len(*devices))
+	for _, device := range *devices {
+		statuses[device.Status]++
+		groups[strconv.FormatInt(device.DeviceGroup, 10)]++
+		if device.IsCharging {
+			charging++
+		}
+		levels = append(levels, float64(device.BatteryLevel))
+	}
+	g.GaugeVec("management_devices_by_status", "Count of devices per status", "status", statuses)
+	g.GaugeVec("management_devices_by_group", "Count of devices per group", "group", groups)
+	g.Gauge("management_devices_charging", "Count of charging devices", charging)
+	g.Histogram("management_battery_level_percent", "Battery levels of all devices", batteryBuckets, levels)
+}
+
+// Writes the connection pool statistics of the database
+func writeDatabaseMetrics(g *GaugeWriter, database *database.Database) {
+	stats := database.DB.Stats()
+	g.Gauge("management_db_max_open_connections", "Max open database connections", float64(stats.MaxOpenConnections))
+	g.Gauge("management_db_open_connections", "Open database connections", float64(stats.OpenConnections))
+	g.Gauge("management_db_in_use_connections", "Database connections in use", float64(stats.InUse))
+	g.Gauge("management_db_idle_connections", "Idle database connections", float64(stats.Idle))
+	g.Gauge("management_db_wait_count", "Total count of waits for a database connection", float64(stats.WaitCount))
+	g.Gauge("management_db_wait_duration_seconds", "Total time waited for a database connection", stats.WaitDuration.Seconds())
+	g.Gauge("management_db_max_idle_closed", "Total count of connections closed because of max idle", float64(stats.MaxIdleClosed))
+	g.Gauge("management_db_max_lifetime_closed", "Total count of connections closed because of max lifetime", float64(stats.MaxLifetimeClosed))
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteSampleEscaping(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"online", `test{user="online"} 1`},
+		{`C:\Users`, `test{user="C:\\Users"} 1`},
+		{`say "hi"`, `test{user="say \"hi\""} 1`},
+		{"two\nlines", `test{user="two\nlines"} 1`},
+		// Non ASCII characters and tabs are not escaped like the %q verb would do
+		{"Müller", `test{user="Müller"} 1`},
+		{"a\tb", "test{user=\"a\tb\"} 1"},
+	}
+	for _, test := range tests {
+		var output bytes.Buffer
+		writeSample(&output, "test", map[string]string{"user": test.value}, 1)
+		if line := strings.TrimSuffix(output.String(), "\n"); line != test.expected {
+			t.Errorf("writeSample(%q) = %s, expected %s", test.value, line, test.expected)
+		}
+	}
+}
+
+func TestWriteSampleLabelOrder(t *testing.T) {
+	var output bytes.Buffer
+	writeSample(&output, "test", map[string]string{"b": "2", "a": "1"}, 0.5)
+	if output.String() != "test{a=\"1\",b=\"2\"} 0.5\n" {
+		t.Errorf("Unexpected sample %q", output.String())
+	}
+	output.Reset()
+	writeSample(&output, "test", nil, 3)
+	if output.String() != "test 3\n" {
+		t.Errorf("Unexpected sample %q", output.String())
+	}
+}
+
+func TestWriteHeaderEscaping(t *testing.T) {
+	var output bytes.Buffer
+	writeHeader(&output, "test", "Path C:\\data\nand \"quotes\"", "gauge")
+	expected := "# HELP test Path C:\\\\data\\nand \"quotes\"\n# TYPE test gauge\n"
+	if output.String() != expected {
+		t.Errorf("Unexpected header %q, expected %q", output.String(), expected)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	counter := &Counter{name: "test_total", help: "Test counter", labels: []string{"result"}, values: map[string]float64{}}
+	counter.Inc("success")
+	counter.Inc("success")
+	counter.Inc("fail\"ed")
+
+	var output bytes.Buffer
+	counter.write(&output)
+	expected := "# HELP test_total Test counter\n" +
+		"# TYPE test_total counter\n" +
+		"test_total{result=\"fail\\\"ed\"} 1\n" +
+		"test_total{result=\"success\"} 2\n"
+	if output.String() != expected {
+		t.Errorf("Unexpected counter:\n%s\nexpected:\n%s", output.String(), expected)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	histogram := newHistogram("test_seconds", "Test histogram", []float64{0.5, 1})
+	histogram.Observe(0.25)
+	histogram.Observe(0.75)
+	histogram.Observe(2)
+
+	var output bytes.Buffer
+	histogram.write(&output)
+	expected := "# HELP test_seconds Test histogram\n" +
+		"# TYPE test_seconds histogram\n" +
+		"test_seconds_bucket{le=\"0.5\"} 1\n" +
+		"test_seconds_bucket{le=\"1\"} 2\n" +
+		"test_seconds_bucket{le=\"+Inf\"} 3\n" +
+		"test_seconds_sum 3\n" +
+		"test_seconds_count 3\n"
+	if output.String() != expected {
+		t.Errorf("Unexpected histogram:\n%s\nexpected:\n%s", output.String(), expected)
+	}
+}
+
+func TestWriteGauges(t *testing.T) {
+	var output bytes.Buffer
+	err := Write(&output, func(g *GaugeWriter) {
+		g.GaugeVec("test_devices", "Devices per user", "user", map[string]float64{"l.müller": 2, "a\\b": 1})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# HELP test_devices Devices per user\n" +
+		"# TYPE test_devices gauge\n" +
+		"test_devices{user=\"a\\\\b\"} 1\n" +
+		"test_devices{user=\"l.müller\"} 2\n"
+	if !strings.HasSuffix(output.String(), expected) {
+		t.Errorf("Unexpected gauges:\n%s\nexpected suffix:\n%s", output.String(), expected)
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type AppChange struct {
+	Id         string    `json:"id"`
+	Identifier string    `json:"identifier"`
+	Name       string    `json:"name"`
+	Change     string    `json:"change"`
+	OldVersion string    `json:"old_version"`
+	NewVersion string    `json:"new_version"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+type AppReportEntry struct {
+	Device          GeneralDevice `json:"device"`
+	Identifier      string        `json:"identifier"`
+	Name            string        `json:"name"`
+	Version         string        `json:"version"`
+	RequiredVersion string        `json:"required_version"`
+}
+
+// AppVersion returns the user visible version of the app
+func (a *InstalledApp) AppVersion() string {
+	if a.ShortVersion != "" {
+		return a.ShortVersion
+	}
+	return a.Version
+}
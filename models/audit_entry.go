@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type AuditEntry struct {
+	Id        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Username  string    `json:"username"`
+	Type      string    `json:"type"`
+	Method    string    `json:"method"`
+	Route     string    `json:"route"`
+	Params    string    `json:"params"`
+	Status    int       `json:"status"`
+	Duration  int64     `json:"duration"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+type CompliancePolicy struct {
+	ExecutedPolicyName    string `json:"executed_policy_name"`
+	ExecutedPolicyVersion int64  `json:"executed_policy_version"`
+	ExecutedPolicyState   string `json:"executed_policy_state"`
+	PolicyName            string `json:"policy_name"`
+	PolicyVersion         int64  `json:"policy_version"`
+	PolicyState           string `json:"policy_state"`
+	RulesetName           string `json:"ruleset_name"`
+	RulesetVersion        int64  `json:"ruleset_version"`
+	NoticeCount           int64  `json:"notice_count"`
+	ViolatedCount         int64  `json:"violated_count"`
+}
+
+type ComplianceState struct {
+	Id string `json:"id"`
+	CompliancePolicy
+	ViolatingSince *time.Time `json:"violating_since"`
+	Timestamp      time.Time  `json:"timestamp"`
+}
+
+type ComplianceReportEntry struct {
+	Device            GeneralDevice   `json:"device"`
+	State             ComplianceState `json:"state"`
+	ViolatingDuration int64           `json:"violating_duration"`
+}
+
+// IsViolating returns if relution reports at least one compliance violation
+func (c *CompliancePolicy) IsViolating() bool {
+	return c.ViolatedCount > 0
+}
+
+func RelutionDeviceToComplianceState(id string, device RelutionDevice) *ComplianceState {
+	return &ComplianceState{
+		Id: id,
+		CompliancePolicy: CompliancePolicy{
+			ExecutedPolicyName:    device.ExecutedPolicy.Name,
+			ExecutedPolicyVersion: int64(device.ExecutedPolicy.Version),
+			ExecutedPolicyState:   device.ExecutedPolicy.State,
+			PolicyName:            device.Details.Policy.Name,
+			PolicyVersion:         int64(device.Details.Policy.Version),
+			PolicyState:           device.Details.Policy.State,
+			RulesetName:           device.Details.Ruleset.Name,
+			RulesetVersion:        int64(device.Details.Ruleset.Version),
+			NoticeCount:           int64(device.Details.ComplianceNoticeCount),
+			ViolatedCount:         int64(device.Details.ComplianceViolatedCount),
+		},
+		Timestamp: time.Now(),
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -190,14 +191,15 @@ type RelutionDevice struct {
 }
 
 func RelutionDeviceToGeneralDevice(device RelutionDevice) (*GeneralDevice, error) {
+	rules := getNamingRules()
 	var deviceType int64 = 0
 	var group int64 = 0
 	var groupIndex = ""
-	if strings.HasPrefix(strings.ToLower(device.Name), "l") {
+	if strings.HasPrefix(strings.ToLower(device.Name), strings.ToLower(rules.TeacherPrefix)) {
 		deviceType += 1
 	}
-	if len(strings.Split(device.Name, "-")) == 2 {
-		fullGroup := strings.Split(device.Name, "-")[1]
+	if len(strings.Split(device.Name, rules.GroupSeparator)) == 2 {
+		fullGroup := strings.Split(device.Name, rules.GroupSeparator)[1]
 		r, _ := regexp.Compile("[0-9]+")
 		var err error
 		group, err = strconv.ParseInt(r.FindString(fullGroup), 10, 64)
@@ -208,8 +210,10 @@ func RelutionDeviceToGeneralDevice(device RelutionDevice) (*GeneralDevice, error
 		}
 	}
 	username := device.Username
-	if username == "AACHEN-VSA Device User" {
-		username = ""
+	for _, ignoredUser := range rules.IgnoredUsers {
+		if username == ignoredUser {
+			username = ""
+		}
 	}
 
 	return &GeneralDevice{
@@ -240,28 +244,47 @@ func HasDeviceTmpAttributesChanged(oldDevice *GeneralDevice, newDevice *GeneralD
 }
 
 func HasObjectChanged(o1 interface{}, o2 interface{}) bool {
+	return len(GetChangedFields(o1, o2)) > 0
+}
+
+// GetChangedFields compares all fields of two objects of the same struct type
+// and returns the changed fields named by their json name
+func GetChangedFields(o1 interface{}, o2 interface{}) []FieldChange {
 	v1 := reflect.ValueOf(o1)
 	v2 := reflect.ValueOf(o2)
 
+	var changes []FieldChange
 	for i := 0; i < v1.NumField(); i++ {
+		field := v1.Type().Field(i)
 		value1 := v1.Field(i).Interface()
 		value2 := v2.Field(i).Interface()
 
-		if v1.Type().Field(i).Name == "Timestamp" {
+		if field.Name == "Timestamp" {
 			continue
 		}
 
 		// If the attribute is a date, compare the dates
+		changed := false
 		if time1, ok := value1.(time.Time); ok {
 			time2 := value2.(time.Time)
-			if !CompareTimes(time1, time2) {
-				return true
+			changed = !CompareTimes(time1, time2)
+		} else {
+			changed = value1 != value2
+		}
+
+		if changed {
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = field.Name
 			}
-		} else if value1 != value2 {
-			return true
+			changes = append(changes, FieldChange{
+				Field:    name,
+				OldValue: fmt.Sprintf("%v", value1),
+				NewValue: fmt.Sprintf("%v", value2),
+			})
 		}
 	}
-	return false
+	return changes
 }
 
 func TimesIsAfter(t1 time.Time, t2 time.Time) bool {
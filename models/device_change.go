@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// TrackedDevice contains all device attributes whose changes are recorded,
+// the frequently changing battery level and connection dates are only stored in the history
+type TrackedDevice struct {
+	Name             string `json:"name"`
+	LoggedinUser     string `json:"loggedin_user"`
+	DeviceType       int64  `json:"device_type"`
+	DeviceGroup      int64  `json:"device_group"`
+	DeviceGroupIndex string `json:"device_group_index"`
+	IsCharging       bool   `json:"is_charging"`
+	Status           string `json:"status"`
+	OsVersion        string `json:"os_version"`
+	BuildVersion     string `json:"build_version"`
+	Model            string `json:"model"`
+	SerialNumber     string `json:"serial_number"`
+	IsSupervised     bool   `json:"is_supervised"`
+	LostMode         bool   `json:"lost_mode"`
+	PolicyName       string `json:"policy_name"`
+}
+
+type FieldChange struct {
+	Field    string `json:"field"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+}
+
+type DeviceChange struct {
+	Id string `json:"id"`
+	FieldChange
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func DeviceToTrackedDevice(device *GeneralDevice, rDevice *RelutionDevice) *TrackedDevice {
+	return &TrackedDevice{
+		Name:             device.Name,
+		LoggedinUser:     device.LoggedinUser,
+		DeviceType:       device.DeviceType,
+		DeviceGroup:      device.DeviceGroup,
+		DeviceGroupIndex: device.DeviceGroupIndex,
+		IsCharging:       device.IsCharging,
+		Status:           device.Status,
+		OsVersion:        rDevice.Details.OsVersion,
+		BuildVersion:     rDevice.Details.BuildVersion,
+		Model:            rDevice.Details.Model,
+		SerialNumber:     rDevice.Details.SerialNumber,
+		IsSupervised:     rDevice.Details.IsSupervised,
+		LostMode:         rDevice.Details.IsMDMLostModeEnabled,
+		PolicyName:       rDevice.Details.Policy.Name,
+	}
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+type DeviceConnection struct {
+	Id       string          `json:"id"`
+	State    string          `json:"state"`
+	Since    time.Time       `json:"since"`
+	LostMode bool            `json:"lost_mode"`
+	Location *DeviceLocation `json:"location"`
+}
+
+type DeviceLocation struct {
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Accuracy  float64   `json:"accuracy"`
+	Time      time.Time `json:"time"`
+}
+
+type ConnectionTransition struct {
+	Id            string    `json:"id"`
+	PreviousState string    `json:"previous_state"`
+	State         string    `json:"state"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+type MissingDevice struct {
+	GeneralDevice
+	Connection DeviceConnection `json:"connection"`
+}
+
+// RelutionDeviceToDeviceLocation returns the last known location of the device,
+// or nil if relution does not know any location
+func RelutionDeviceToDeviceLocation(device RelutionDevice) *DeviceLocation {
+	location := device.Details.Location
+	if location.Time == 0 {
+		return nil
+	}
+	return &DeviceLocation{
+		Latitude:  location.Latitude,
+		Longitude: location.Longitude,
+		Accuracy:  location.Accuracy,
+		Time:      parseUtcUnixTime(int64(location.Time)),
+	}
+}
@@ -0,0 +1,97 @@
+package models
+
+import "time"
+
+type DeviceDetails struct {
+	Id                            string    `json:"id"`
+	Platform                      string    `json:"platform"`
+	Manufacturer                  string    `json:"manufacturer"`
+	Model                         string    `json:"model"`
+	ModelName                     string    `json:"model_name"`
+	ProductName                   string    `json:"product_name"`
+	SerialNumber                  string    `json:"serial_number"`
+	OsVersion                     string    `json:"os_version"`
+	BuildVersion                  string    `json:"build_version"`
+	DeviceCapacity                float64   `json:"device_capacity"`
+	AvailableDeviceCapacity       float64   `json:"available_device_capacity"`
+	IsSupervised                  bool      `json:"is_supervised"`
+	IsActivationLockEnabled       bool      `json:"is_activation_lock_enabled"`
+	IsDeviceLocatorServiceEnabled bool      `json:"is_device_locator_service_enabled"`
+	IsCloudBackupEnabled          bool      `json:"is_cloud_backup_enabled"`
+	Jailbroken                    bool      `json:"jailbroken"`
+	EnrollmentDate                time.Time `json:"enrollment_date"`
+	Timestamp                     time.Time `json:"timestamp"`
+}
+
+type InstalledApp struct {
+	Id                 string `json:"id"`
+	Identifier         string `json:"identifier"`
+	Name               string `json:"name"`
+	Version            string `json:"version"`
+	ShortVersion       string `json:"short_version"`
+	Managed            bool   `json:"managed"`
+	HasUpdateAvailable bool   `json:"has_update_available"`
+	BundleSize         int64  `json:"bundle_size"`
+	DynamicSize        int64  `json:"dynamic_size"`
+}
+
+type DeviceProfile struct {
+	Id         string `json:"id"`
+	Uuid       string `json:"uuid"`
+	Name       string `json:"name"`
+	Identifier string `json:"identifier"`
+}
+
+func RelutionDeviceToDeviceDetails(id string, device RelutionDevice) *DeviceDetails {
+	return &DeviceDetails{
+		Id:                            id,
+		Platform:                      device.Platform,
+		Manufacturer:                  device.Manufacturer,
+		Model:                         device.Details.Model,
+		ModelName:                     device.Details.ModelName,
+		ProductName:                   device.Details.ProductName,
+		SerialNumber:                  device.Details.SerialNumber,
+		OsVersion:                     device.Details.OsVersion,
+		BuildVersion:                  device.Details.BuildVersion,
+		DeviceCapacity:                device.Details.DeviceCapacity,
+		AvailableDeviceCapacity:       device.Details.AvailableDeviceCapacity,
+		IsSupervised:                  device.Details.IsSupervised,
+		IsActivationLockEnabled:       device.Details.IsActivationLockEnabled,
+		IsDeviceLocatorServiceEnabled: device.Details.IsDeviceLocatorServiceEnabled,
+		IsCloudBackupEnabled:          device.Details.IsCloudBackupEnabled,
+		Jailbroken:                    device.Jailbroken,
+		EnrollmentDate:                parseUtcUnixTime(int64(device.EnrollmentDate)),
+		Timestamp:                     time.Now(),
+	}
+}
+
+func RelutionDeviceToInstalledApps(id string, device RelutionDevice) []InstalledApp {
+	apps := []InstalledApp{}
+	for _, app := range device.InstalledApps {
+		apps = append(apps, InstalledApp{
+			Id:                 id,
+			Identifier:         app.Identifier,
+			Name:               app.Name,
+			Version:            app.Version,
+			ShortVersion:       app.ShortVersion,
+			Managed:            app.Managed,
+			HasUpdateAvailable: app.HasUpdateAvailable,
+			BundleSize:         int64(app.BundleSize),
+			DynamicSize:        int64(app.DynamicSize),
+		})
+	}
+	return apps
+}
+
+func RelutionDeviceToDeviceProfiles(id string, device RelutionDevice) []DeviceProfile {
+	profiles := []DeviceProfile{}
+	for _, profile := range device.Details.Profiles {
+		profiles = append(profiles, DeviceProfile{
+			Id:         id,
+			Uuid:       profile.Uuid,
+			Name:       profile.Name,
+			Identifier: profile.Identifier,
+		})
+	}
+	return profiles
+}
@@ -0,0 +1,17 @@
+package models
+
+type DeviceGroup struct {
+	Id                 int64  `json:"id"`
+	Name               string `json:"name"`
+	Location           string `json:"location"`
+	ResponsibleTeacher string `json:"responsible_teacher"`
+	ExpectedDevices    int64  `json:"expected_devices"`
+}
+
+type DeviceGroupStatus struct {
+	DeviceGroup
+	Present        int64   `json:"present"`
+	Missing        int64   `json:"missing"`
+	Charging       int64   `json:"charging"`
+	AverageBattery float64 `json:"average_battery"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type HistoryAggregate struct {
+	Id           string    `json:"id"`
+	Period       time.Time `json:"period"`
+	Level        float64   `json:"level"`
+	MinLevel     int64     `json:"min_level"`
+	MaxLevel     int64     `json:"max_level"`
+	Samples      int64     `json:"samples"`
+	LoggedinUser string    `json:"loggedin_user"`
+	Status       string    `json:"status"`
+}
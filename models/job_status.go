@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type JobStatus struct {
+	Name      string    `json:"name"`
+	Schedule  string    `json:"schedule"`
+	Running   bool      `json:"running"`
+	LastStart time.Time `json:"last_start"`
+	LastEnd   time.Time `json:"last_end"`
+	LastError string    `json:"last_error"`
+	Runs      int64     `json:"runs"`
+	Failures  int64     `json:"failures"`
+	NextRun   time.Time `json:"next_run"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type Lending struct {
+	Id           int64      `json:"id"`
+	DeviceId     string     `json:"device_id"`
+	Borrower     string     `json:"borrower"`
+	BorrowerType string     `json:"borrower_type"`
+	IssuedBy     string     `json:"issued_by"`
+	CheckedOut   time.Time  `json:"checked_out"`
+	Due          *time.Time `json:"due"`
+	CheckedIn    *time.Time `json:"checked_in"`
+	ReturnedTo   string     `json:"returned_to"`
+	Note         string     `json:"note"`
+}
+
+// IsOverdue returns if the device is not returned and the due date is already over
+func (l *Lending) IsOverdue(now time.Time) bool {
+	return l.CheckedIn == nil && l.Due != nil && l.Due.Before(now)
+}
@@ -0,0 +1,34 @@
+package models
+
+import "sync/atomic"
+
+// NamingRules configure how the relution device names and users are parsed
+type NamingRules struct {
+	// Devices with a name starting with the prefix are teacher devices
+	TeacherPrefix string
+	// Separates the group (e.g. 5a) from the rest of the device name
+	GroupSeparator string
+	// Users that are reported as logged in, but are no real users
+	IgnoredUsers []string
+}
+
+// DefaultNamingRules are used until other rules are set
+var DefaultNamingRules = NamingRules{
+	TeacherPrefix:  "l",
+	GroupSeparator: "-",
+	IgnoredUsers:   []string{"AACHEN-VSA Device User"},
+}
+
+var namingRules atomic.Value
+
+// SetNamingRules replaces the rules for all following conversions
+func SetNamingRules(rules NamingRules) {
+	namingRules.Store(rules)
+}
+
+func getNamingRules() NamingRules {
+	if rules, ok := namingRules.Load().(NamingRules); ok {
+		return rules
+	}
+	return DefaultNamingRules
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+type OsVersionEntry struct {
+	Id           string    `json:"id"`
+	OsVersion    string    `json:"os_version"`
+	BuildVersion string    `json:"build_version"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+type OsUpdateState struct {
+	Id               string    `json:"id"`
+	ProductKey       string    `json:"product_key"`
+	UpdateStatus     string    `json:"update_status"`
+	DownloadPercent  float64   `json:"download_percent"`
+	Downloaded       bool      `json:"downloaded"`
+	ErrorCount       int64     `json:"error_count"`
+	AvailableUpdates int64     `json:"available_updates"`
+	LastStatusTime   time.Time `json:"last_status_time"`
+	LastProgress     time.Time `json:"last_progress"`
+}
+
+type OsReportEntry struct {
+	Device         GeneralDevice  `json:"device"`
+	OsVersion      string         `json:"os_version"`
+	BuildVersion   string         `json:"build_version"`
+	MinimumVersion string         `json:"minimum_version,omitempty"`
+	Update         *OsUpdateState `json:"update,omitempty"`
+}
+
+func RelutionDeviceToOsUpdateState(id string, device RelutionDevice) *OsUpdateState {
+	update := device.Details.CurrentOSUpdate
+	return &OsUpdateState{
+		Id:               id,
+		ProductKey:       update.ProductKey,
+		UpdateStatus:     update.UpdateStatus,
+		DownloadPercent:  update.DownloadPercentComplete,
+		Downloaded:       update.Downloaded,
+		ErrorCount:       int64(len(update.ErrorChain)),
+		AvailableUpdates: int64(len(device.Details.AvailableUpdates)),
+		LastStatusTime:   parseUtcUnixTime(int64(update.LastUpdateStatusTime)),
+		LastProgress:     time.Now(),
+	}
+}
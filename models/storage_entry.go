@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type StorageEntry struct {
+	Id        string    `json:"id"`
+	Capacity  float64   `json:"capacity"`
+	Available float64   `json:"available"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type StorageReportEntry struct {
+	Device      GeneralDevice `json:"device"`
+	Capacity    float64       `json:"capacity"`
+	Available   float64       `json:"available"`
+	FreePercent float64       `json:"free_percent"`
+	NearlyFull  bool          `json:"nearly_full"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type SyncRun struct {
+	Id             int64     `json:"id"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	DevicesSeen    int       `json:"devices_seen"`
+	DevicesChanged int       `json:"devices_changed"`
+	HistoryEntries int       `json:"history_entries"`
+	Errors         []string  `json:"errors"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type UsageEntry struct {
+	Day             time.Time `json:"day"`
+	Scope           string    `json:"scope"`
+	Key             string    `json:"key"`
+	LoggedInSeconds int64     `json:"logged_in_seconds"`
+	BatteryConsumed int64     `json:"battery_consumed"`
+	Sessions        int64     `json:"sessions"`
+}
@@ -0,0 +1,13 @@
+package osupdate
+
+import "time"
+
+// The name of the setting with the minimum os version
+const minimumVersionSetting = "os_minimum_version"
+
+// The default duration without download progress after an update is stalled (1d)
+const defaultStalledAfter = time.Hour * 24
+
+type MinimumVersionRequest struct {
+	Version string `json:"version" binding:"required"`
+}
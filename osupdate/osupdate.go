@@ -0,0 +1,314 @@
+package osupdate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/details"
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+// The latest os versions and update states of all devices
+var oldVersions map[string]models.OsVersionEntry
+var oldUpdates map[string]models.OsUpdateState
+
+// The changed os versions and update states of the current sync
+var changedVersions []models.OsVersionEntry
+var changedUpdates []models.OsUpdateState
+
+// Prepares the os version synchronization
+func StartSync(ctx context.Context, database *database.Database) {
+	changedVersions = []models.OsVersionEntry{}
+	changedUpdates = []models.OsUpdateState{}
+
+	var err error
+	oldVersions, err = getLatestVersions(ctx, database)
+	if err != nil {
+		log.Warnf("Error during fetching old os versions: %v", err)
+		oldVersions = map[string]models.OsVersionEntry{}
+	}
+	oldUpdates, err = GetUpdateStates(ctx, database)
+	if err != nil {
+		log.Warnf("Error during fetching old os update states: %v", err)
+		oldUpdates = map[string]models.OsUpdateState{}
+	}
+}
+
+// Compares the os version and the update state of the device with the stored ones
+func SyncDevice(device *models.GeneralDevice, rDevice *models.RelutionDevice) {
+	version, exists := oldVersions[device.Id]
+	if !exists || version.OsVersion != rDevice.Details.OsVersion || version.BuildVersion != rDevice.Details.BuildVersion {
+		changedVersions = append(changedVersions, models.OsVersionEntry{
+			Id:           device.Id,
+			OsVersion:    rDevice.Details.OsVersion,
+			BuildVersion: rDevice.Details.BuildVersion,
+			Timestamp:    time.Now(),
+		})
+	}
+
+	update := models.RelutionDeviceToOsUpdateState(device.Id, *rDevice)
+	oldUpdate, exists := oldUpdates[device.Id]
+	if exists && oldUpdate.ProductKey == update.ProductKey && oldUpdate.DownloadPercent == update.DownloadPercent {
+		// Keep the time of the last progress, if the download did not progress
+		update.LastProgress = oldUpdate.LastProgress
+	}
+	if !exists || models.HasObjectChanged(oldUpdate, *update) {
+		changedUpdates = append(changedUpdates, *update)
+	}
+}
+
+// Stores all changed os versions and update states
+func EndSync(ctx context.Context, database *database.Database) error {
+	var lastErr error
+	failed := 0
+	for _, version := range changedVersions {
+		_, err := database.DB.ExecContext(ctx,
+			"INSERT INTO os_history VALUES (?, ?, ?, ?)",
+			version.Id,
+			version.OsVersion,
+			version.BuildVersion,
+			version.Timestamp.UTC().Format(helper.SqlDateFormat),
+		)
+		if err != nil {
+			log.Warnf("Error adding os version entry: %v", err)
+			lastErr = err
+			failed++
+		}
+	}
+	for _, update := range changedUpdates {
+		_, err := database.DB.ExecContext(ctx,
+			"REPLACE INTO os_updates VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			update.Id,
+			update.ProductKey,
+			update.UpdateStatus,
+			update.DownloadPercent,
+			update.Downloaded,
+			update.ErrorCount,
+			update.AvailableUpdates,
+			update.LastStatusTime.UTC().Format(helper.SqlDateFormat),
+			update.LastProgress.UTC().Format(helper.SqlDateFormat),
+		)
+		if err != nil {
+			log.Warnf("Error updating os update state: %v", err)
+			lastErr = err
+			failed++
+		}
+	}
+	if len(changedVersions) > 0 || len(changedUpdates) > 0 {
+		log.Debugf("Updated %d os versions and %d os update states", len(changedVersions), len(changedUpdates))
+	}
+	if failed > 0 {
+		return fmt.Errorf("error updating %d os versions or update states: %v", failed, lastErr)
+	}
+	return nil
+}
+
+// GetMinimumVersion returns the minimum os version set by an admin or else from the config
+func GetMinimumVersion(ctx context.Context, database *database.Database, config *config.Config) (string, error) {
+	version, isSet, err := database.GetSetting(ctx, minimumVersionSetting)
+	if err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return "", &helper.LoadError{Msg: "Database query failed"}
+	}
+	if isSet {
+		return version, nil
+	}
+	return config.OsUpdate.MinimumVersion, nil
+}
+
+// SetMinimumVersion stores the minimum os version, which overrides the configured one
+func SetMinimumVersion(ctx context.Context, database *database.Database, version string) error {
+	if err := database.SetSetting(ctx, minimumVersionSetting, version); err != nil {
+		log.Errorf("Error setting minimum os version: %v", err)
+		return &helper.LoadError{Msg: "Database query failed"}
+	}
+	return nil
+}
+
+// ClearMinimumVersion removes the stored minimum os version, so the configured one is used again
+func ClearMinimumVersion(ctx context.Context, database *database.Database) error {
+	if err := database.RemoveSetting(ctx, minimumVersionSetting); err != nil {
+		log.Errorf("Error removing minimum os version: %v", err)
+		return &helper.LoadError{Msg: "Database query failed"}
+	}
+	return nil
+}
+
+// GetNonCompliantDevices returns all devices with an os version lower than the minimum version
+func GetNonCompliantDevices(ctx context.Context, database *database.Database, config *config.Config, devices []models.GeneralDevice) ([]models.OsReportEntry, error) {
+	minimumVersion, err := GetMinimumVersion(ctx, database, config)
+	if err != nil {
+		return nil, err
+	}
+	entries := []models.OsReportEntry{}
+	if minimumVersion == "" {
+		return entries, nil
+	}
+	allDetails, err := details.GetAllDetails(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	updates, err := GetUpdateStates(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, device := range devices {
+		deviceDetails, exists := allDetails[device.Id]
+		if !exists {
+			continue
+		}
+		compared, err := helper.CompareVersions(deviceDetails.OsVersion, minimumVersion)
+		if err != nil {
+			log.Warnf("Cannot compare os version of device %s: %v", device.Id, err)
+			continue
+		}
+		if compared >= 0 {
+			continue
+		}
+		entry := models.OsReportEntry{
+			Device:         device,
+			OsVersion:      deviceDetails.OsVersion,
+			BuildVersion:   deviceDetails.BuildVersion,
+			MinimumVersion: minimumVersion,
+		}
+		if update, exists := updates[device.Id]; exists {
+			entry.Update = &update
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// GetStalledUpdates returns all devices with an update with errors
+// or without download progress in the configured duration
+func GetStalledUpdates(ctx context.Context, database *database.Database, config *config.Config, devices []models.GeneralDevice) ([]models.OsReportEntry, error) {
+	stalledAfter := config.OsUpdate.StalledAfter
+	if stalledAfter <= 0 {
+		stalledAfter = defaultStalledAfter
+	}
+	allDetails, err := details.GetAllDetails(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	updates, err := GetUpdateStates(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []models.OsReportEntry{}
+	for _, device := range devices {
+		update, exists := updates[device.Id]
+		if !exists || update.ProductKey == "" {
+			continue
+		}
+		isStalled := !update.Downloaded && time.Since(update.LastProgress) >= stalledAfter
+		if update.ErrorCount > 0 || isStalled {
+			deviceDetails := allDetails[device.Id]
+			entries = append(entries, models.OsReportEntry{
+				Device:       device,
+				OsVersion:    deviceDetails.OsVersion,
+				BuildVersion: deviceDetails.BuildVersion,
+				Update:       &update,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// GetVersionHistory returns all os versions of the device, newest first
+func GetVersionHistory(ctx context.Context, database *database.Database, id string) ([]models.OsVersionEntry, error) {
+	rows, _err := database.DB.QueryContext(ctx, "SELECT * FROM os_history WHERE id = ? ORDER BY timestamp DESC", id)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+	return scanVersions(rows)
+}
+
+// GetUpdateStates returns the os update states of all devices
+func GetUpdateStates(ctx context.Context, database *database.Database) (map[string]models.OsUpdateState, error) {
+	rows, _err := database.DB.QueryContext(ctx, "SELECT * FROM os_updates")
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	updates := map[string]models.OsUpdateState{}
+	for rows.Next() {
+		update := models.OsUpdateState{}
+		var statusTime, progress mysql.NullTime
+		err := rows.Scan(&update.Id, &update.ProductKey, &update.UpdateStatus, &update.DownloadPercent, &update.Downloaded, &update.ErrorCount, &update.AvailableUpdates, &statusTime, &progress)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		if statusTime.Valid {
+			update.LastStatusTime = statusTime.Time
+		}
+		if progress.Valid {
+			update.LastProgress = progress.Time
+		}
+		updates[update.Id] = update
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return updates, nil
+}
+
+// Returns the latest os version of all devices
+func getLatestVersions(ctx context.Context, database *database.Database) (map[string]models.OsVersionEntry, error) {
+	rows, _err := database.DB.QueryContext(ctx, "SELECT h.* FROM os_history h INNER JOIN (SELECT id, MAX(timestamp) AS timestamp FROM os_history GROUP BY id) latest ON h.id = latest.id AND h.timestamp = latest.timestamp")
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	versions, err := scanVersions(rows)
+	if err != nil {
+		return nil, err
+	}
+	latest := map[string]models.OsVersionEntry{}
+	for _, version := range versions {
+		latest[version.Id] = version
+	}
+	return latest, nil
+}
+
+func scanVersions(rows *sql.Rows) ([]models.OsVersionEntry, error) {
+	versions := []models.OsVersionEntry{}
+	for rows.Next() {
+		version := models.OsVersionEntry{}
+		var timestamp mysql.NullTime
+		err := rows.Scan(&version.Id, &version.OsVersion, &version.BuildVersion, &timestamp)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		if timestamp.Valid {
+			version.Timestamp = timestamp.Time
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return versions, nil
+}
@@ -0,0 +1,95 @@
+package osupdate
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/viktoriaschule/management-server/audit"
+	"github.com/viktoriaschule/management-server/auth"
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/export"
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+func Serve(root *gin.RouterGroup, admin *gin.RouterGroup, database *database.Database, getConfig func() *config.Config, getDevices func(context.Context, *database.Database) (*[]models.GeneralDevice, error)) {
+	root.GET("/os/noncompliant", func(c *gin.Context) {
+		devices, err := getDevices(c.Request.Context(), database)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		entries, err := GetNonCompliantDevices(c.Request.Context(), database, getConfig(), *devices)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "devices", entries)
+	})
+
+	root.GET("/os/stalled", func(c *gin.Context) {
+		devices, err := getDevices(c.Request.Context(), database)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		entries, err := GetStalledUpdates(c.Request.Context(), database, getConfig(), *devices)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "devices", entries)
+	})
+
+	root.GET("/os/minimum", func(c *gin.Context) {
+		version, err := GetMinimumVersion(c.Request.Context(), database, getConfig())
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"version": version})
+	})
+
+	admin.PUT("/os/minimum", func(c *gin.Context) {
+		request := MinimumVersionRequest{}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(400, gin.H{"error": "Wrong body format"})
+			return
+		}
+		if _, err := helper.ParseVersion(request.Version); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid version, expected a dotted numeric version like 13.4.1"})
+			return
+		}
+		if err := SetMinimumVersion(c.Request.Context(), database, request.Version); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		audit.RecordAction(database, auth.GetUser(c).Username, "set_os_minimum_version", request)
+		c.JSON(200, gin.H{"version": request.Version})
+	})
+
+	admin.DELETE("/os/minimum", func(c *gin.Context) {
+		if err := ClearMinimumVersion(c.Request.Context(), database); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		audit.RecordAction(database, auth.GetUser(c).Username, "clear_os_minimum_version", nil)
+		version, err := GetMinimumVersion(c.Request.Context(), database, getConfig())
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"version": version})
+	})
+
+	root.GET("/devices/:id/os/history", func(c *gin.Context) {
+		versions, err := GetVersionHistory(c.Request.Context(), database, c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "versions", versions)
+	})
+}
@@ -1,6 +1,28 @@
 package relution
 
-import "github.com/viktoriaschule/management-server/models"
+import (
+	"strings"
+	"time"
+
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/models"
+	"github.com/viktoriaschule/management-server/schedule"
+)
+
+// SyncJob is the name of the scheduled sync job
+const SyncJob = "sync"
+
+// DefaultSyncInterval is the interval of the sync job without a configured schedule
+const DefaultSyncInterval = time.Minute
+
+// SyncSchedule returns the configured schedule of the sync job
+func SyncSchedule(c *config.Config) (schedule.Schedule, error) {
+	jobConfig := c.Jobs[SyncJob]
+	return schedule.Parse(jobConfig.Interval, jobConfig.Cron, DefaultSyncInterval)
+}
+
+// The filter for all devices, which are in a group or teacher devices
+const validDevicesFilter = "(device_group != 0 OR device_type = 1)"
 
 type relutionDevicesResponse struct {
 	Status  string
@@ -9,3 +31,44 @@ type relutionDevicesResponse struct {
 	Total   int
 	Results []models.RelutionDevice
 }
+
+// DeviceFilter filters the valid devices by their attributes, unset attributes are ignored
+type DeviceFilter struct {
+	Group      *int64 `form:"group"`
+	GroupIndex string `form:"group_index"`
+	Type       *int64 `form:"type"`
+	Status     string `form:"status"`
+	User       string `form:"user"`
+	Charging   *bool  `form:"charging"`
+}
+
+// Returns the sql where clause and the arguments of the filter
+func (f *DeviceFilter) sql() (string, []interface{}) {
+	conditions := []string{validDevicesFilter}
+	var args []interface{}
+	if f.Group != nil {
+		conditions = append(conditions, "device_group = ?")
+		args = append(args, *f.Group)
+	}
+	if f.GroupIndex != "" {
+		conditions = append(conditions, "device_group_index = ?")
+		args = append(args, f.GroupIndex)
+	}
+	if f.Type != nil {
+		conditions = append(conditions, "device_type = ?")
+		args = append(args, *f.Type)
+	}
+	if f.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, f.Status)
+	}
+	if f.User != "" {
+		conditions = append(conditions, "loggedin_user = ?")
+		args = append(args, f.User)
+	}
+	if f.Charging != nil {
+		conditions = append(conditions, "is_charging = ?")
+		args = append(args, *f.Charging)
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
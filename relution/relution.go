@@ -1,79 +1,124 @@
 package relution
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
 
+	"github.com/viktoriaschule/management-server/apps"
+	"github.com/viktoriaschule/management-server/changes"
+	"github.com/viktoriaschule/management-server/compliance"
 	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/connection"
 	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/details"
 	"github.com/viktoriaschule/management-server/helper"
 	"github.com/viktoriaschule/management-server/history"
 	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/metrics"
 	"github.com/viktoriaschule/management-server/models"
+	"github.com/viktoriaschule/management-server/osupdate"
+	"github.com/viktoriaschule/management-server/scheduler"
+	"github.com/viktoriaschule/management-server/storage"
 )
 
 type Relution struct {
-	config   *config.Config
+	config   func() *config.Config
 	database *database.Database
 	devices  []models.RelutionDevice
 }
 
-func NewRelution(config *config.Config, database *database.Database) *Relution {
+func NewRelution(config func() *config.Config, database *database.Database) *Relution {
 	return &Relution{config: config, database: database}
 }
 
-func (r *Relution) FetchDevices() {
-	log.Debugf("Fetching devices...")
-	url := fmt.Sprintf("https://%s/relution/api/v1/devices", r.config.Relution.Host)
-	req, err := http.NewRequest("GET", url, nil)
+// The end of the last successful sync as unix nanoseconds
+var lastSuccessfulSync int64
+
+// LastSuccessfulSync returns the end of the last successful sync, or zero if there was none
+func LastSuccessfulSync() time.Time {
+	nanos := atomic.LoadInt64(&lastSuccessfulSync)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// FetchDevices synchronizes all devices from relution and records the sync run and metrics
+// The sync is aborted when the context is canceled or the optional sync timeout is exceeded
+// before the devices are saved, the saving itself is never interrupted
+func (r *Relution) FetchDevices(ctx context.Context) error {
+	// The whole sync uses the same config, even if it is reloaded meanwhile
+	c := r.config()
+	if timeout := c.Relution.SyncTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	run := &models.SyncRun{Start: time.Now(), Errors: []string{}}
+	err := r.fetchDevices(ctx, c, run)
+	run.End = time.Now()
+	metrics.SyncDuration.ObserveSince(run.Start)
+	if err != nil {
+		run.Errors = append(run.Errors, err.Error())
+	}
+	// Also saved if the sync was canceled, so the failed run is listed
+	addSyncRun(r.database, run)
+	scheduler.SetResult(ctx, run)
+
 	if err != nil {
-		log.Errorf("Error reading request: %v", err)
-		os.Exit(1)
+		metrics.Syncs.Inc("failure")
+		return errors.Wrap(err, "fetching devices failed")
 	}
+	metrics.Syncs.Inc("success")
+	atomic.StoreInt64(&lastSuccessfulSync, time.Now().UnixNano())
+	return nil
+}
 
-	req.Header.Set("X-User-Access-Token", r.config.Relution.Token)
+func (r *Relution) fetchDevices(ctx context.Context, c *config.Config, run *models.SyncRun) error {
+	logger := log.With("job", "sync")
+	logger.Debugf("Fetching devices...")
+	url := fmt.Sprintf("https://%s/relution/api/v1/devices", c.Relution.Host)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return errors.Wrap(err, "error reading request")
+	}
+
+	req.Header.Set("X-User-Access-Token", c.RelutionToken())
 
 	client := &http.Client{Timeout: time.Second * 10}
 
+	requestStart := time.Now()
 	resp, err := client.Do(req)
+	metrics.RelutionDuration.ObserveSince(requestStart)
 	if err != nil {
-		log.Errorf("Error reading response: %v", err)
-		os.Exit(1)
+		return errors.Wrap(err, "error reading response")
 	}
 	//noinspection GoUnhandledErrorResult
 	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Errorf("Error reading body: %v", err)
-		os.Exit(1)
+		return errors.Wrap(err, "error reading body")
 	}
 
 	var devicesResponse relutionDevicesResponse
 	err = json.Unmarshal(body, &devicesResponse)
 	if err != nil {
-		log.Errorf("Error parsing json: %v", err)
-		os.Exit(1)
+		return errors.Wrap(err, "error parsing json")
 	}
-	stmtIns, err := r.database.DB.Prepare("INSERT INTO devices VALUES( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? ) ON DUPLICATE KEY UPDATE id = ?, name = ?, loggedin_user = ?, device_type = ?, battery_level = ?, is_charging = ?, device_group = ?, device_group_index = ?, last_modified = ?, last_connection = ?, status = ?")
-	if err != nil {
-		log.Errorf("Error preparing insert statement: %v", err)
-		os.Exit(1)
-	}
-	//noinspection GoUnhandledErrorResult
-	defer stmtIns.Close()
-
 	// Get all current devices
-	_oldDevices, err := getLoadedDevices(r.database, "")
+	_oldDevices, err := getLoadedDevices(ctx, r.database, "")
 	if err != nil {
-		log.Errorf("Error fetching old devices: %v", err)
-		os.Exit(1)
+		return errors.Wrap(err, "error fetching old devices")
 	}
 
 	// Convert devices list to map
@@ -82,16 +127,27 @@ func (r *Relution) FetchDevices() {
 		oldDevices[device.Id] = device
 	}
 
-	changedCount := 0
+	// The changed devices are saved after all other sync data, so an aborted sync does not save devices
+	// without their history and changes and a saved device is never seen as unchanged by the next sync
+	var changedDevices []models.GeneralDevice
+	run.DevicesSeen = len(devicesResponse.Results)
 
 	// Start charging sync
-	history.StartSync(r.database)
+	history.StartSync(ctx, r.database)
+	changes.StartSync(ctx, r.database)
+	connection.StartSync(ctx, r.database)
+	details.StartSync(ctx, r.database)
+	apps.StartSync(ctx, r.database)
+	osupdate.StartSync(ctx, r.database)
+	storage.StartSync(ctx, r.database)
+	compliance.StartSync(ctx, r.database)
 
 	for _, rDevice := range devicesResponse.Results {
 		// Get the device
 		gDevice, err := models.RelutionDeviceToGeneralDevice(rDevice)
 		if err != nil {
-			log.Warnf("Error converting relution device to general device: %v", err)
+			logger.With("device", rDevice.Name).Warnf("Error converting relution device to general device: %v", err)
+			run.Errors = append(run.Errors, fmt.Sprintf("Error converting device %s: %v", rDevice.Name, err))
 			continue
 		}
 
@@ -101,63 +157,163 @@ func (r *Relution) FetchDevices() {
 		// Sync the charging mode for the device
 		history.SyncDevice(gDevice, &oldDevice, !isOld)
 
+		// Record all changed fields, after the charging state is updated
+		changes.SyncDevice(gDevice, &rDevice)
+
+		// Sync the lost mode and location of the device
+		connection.SyncDevice(gDevice, &rDevice)
+
+		// Sync the device metadata, installed apps and profiles
+		details.SyncDevice(gDevice, &rDevice)
+		apps.SyncDevice(gDevice, &rDevice)
+
+		// Sync the os version and update state of the device
+		osupdate.SyncDevice(gDevice, &rDevice)
+
+		// Sync the storage capacity of the device
+		storage.SyncDevice(gDevice, &rDevice)
+
+		// Sync the policies and compliance violations of the device
+		compliance.SyncDevice(gDevice, &rDevice)
+
 		// Add or change device entry
 		datesAreEquals := models.CompareTimes(gDevice.LastModified, oldDevice.LastModified)
 		if !isOld || models.TimesIsAfter(gDevice.LastModified, oldDevice.LastModified) || (datesAreEquals && models.HasDeviceTmpAttributesChanged(gDevice, &oldDevice)) {
 			oldDevices[gDevice.Id] = *gDevice
-			_, err = stmtIns.Exec(
-				gDevice.Id,
-				gDevice.Name,
-				gDevice.LoggedinUser,
-				gDevice.DeviceType,
-				gDevice.BatteryLevel,
-				gDevice.IsCharging,
-				gDevice.DeviceGroup,
-				gDevice.DeviceGroupIndex,
-				gDevice.LastModified.UTC().Format(helper.SqlDateFormat),
-				gDevice.LastConnection.UTC().Format(helper.SqlDateFormat),
-				gDevice.Status,
-				gDevice.Id,
-				gDevice.Name,
-				gDevice.LoggedinUser,
-				gDevice.DeviceType,
-				gDevice.BatteryLevel,
-				gDevice.IsCharging,
-				gDevice.DeviceGroup,
-				gDevice.DeviceGroupIndex,
-				gDevice.LastModified.UTC().Format(helper.SqlDateFormat),
-				gDevice.LastConnection.UTC().Format(helper.SqlDateFormat),
-				gDevice.Status,
-			)
-			if err != nil {
-				log.Warnf("Error executing insert statement: %v", err)
-			}
-			changedCount++
+			changedDevices = append(changedDevices, *gDevice)
 		} else if isOld && datesAreEquals && models.HasDeviceChanged(gDevice, &oldDevice) {
-			log.Warnf("Device has changed, but not the last modified")
+			logger.With("device", gDevice.Id).Warnf("Device has changed, but not the last modified")
 		}
 	}
-	if changedCount > 0 {
-		log.Infof("Fetched devices (%d have changed)", changedCount)
+	if len(changedDevices) > 0 {
+		logger.Infof("Fetched devices (%d have changed)", len(changedDevices))
 	} else {
-		log.Debugf("Fetched devices (no changes)")
+		logger.Debugf("Fetched devices (no changes)")
+	}
+
+	// Nothing is saved yet, so the sync can be aborted without losing changes
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "sync aborted")
+	}
+	// A partially written sync would lose history entries and changes, so the writes are not canceled
+	ctx = context.Background()
+
+	run.DevicesChanged = len(changedDevices)
+	run.HistoryEntries, err = history.EndSync(ctx, r.database)
+	if err != nil {
+		run.Errors = append(run.Errors, fmt.Sprintf("Error adding history entries: %v", err))
+	}
+	addError := func(err error) {
+		if err != nil {
+			run.Errors = append(run.Errors, err.Error())
+		}
 	}
+	addError(changes.EndSync(ctx, r.database))
+	addError(details.EndSync(ctx, r.database))
+	addError(apps.EndSync(ctx, r.database))
+	addError(osupdate.EndSync(ctx, r.database))
+	addError(storage.EndSync(ctx, r.database, c))
+	addError(compliance.EndSync(ctx, r.database))
 
-	history.EndSync(r.database)
+	devices := make([]models.GeneralDevice, 0, len(oldDevices))
+	for _, device := range oldDevices {
+		devices = append(devices, device)
+	}
+	addError(connection.EndSync(ctx, r.database, c, devices))
+
+	return r.saveDevices(ctx, changedDevices, run)
 }
 
-func GetValidLoadedDevices(database *database.Database) (devices *[]models.GeneralDevice, err error) {
-	return getLoadedDevices(database, "WHERE device_group != 0 OR device_type = 1")
+// Inserts or updates the changed devices in one transaction
+func (r *Relution) saveDevices(ctx context.Context, devices []models.GeneralDevice, run *models.SyncRun) error {
+	if len(devices) == 0 {
+		return nil
+	}
+	tx, err := r.database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "error starting device transaction")
+	}
+	stmtIns, err := tx.PrepareContext(ctx, "INSERT INTO devices VALUES( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? ) ON DUPLICATE KEY UPDATE id = ?, name = ?, loggedin_user = ?, device_type = ?, battery_level = ?, is_charging = ?, device_group = ?, device_group_index = ?, last_modified = ?, last_connection = ?, status = ?")
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, "error preparing insert statement")
+	}
+	//noinspection GoUnhandledErrorResult
+	defer stmtIns.Close()
+
+	for _, gDevice := range devices {
+		_, err = stmtIns.ExecContext(ctx,
+			gDevice.Id,
+			gDevice.Name,
+			gDevice.LoggedinUser,
+			gDevice.DeviceType,
+			gDevice.BatteryLevel,
+			gDevice.IsCharging,
+			gDevice.DeviceGroup,
+			gDevice.DeviceGroupIndex,
+			gDevice.LastModified.UTC().Format(helper.SqlDateFormat),
+			gDevice.LastConnection.UTC().Format(helper.SqlDateFormat),
+			gDevice.Status,
+			gDevice.Id,
+			gDevice.Name,
+			gDevice.LoggedinUser,
+			gDevice.DeviceType,
+			gDevice.BatteryLevel,
+			gDevice.IsCharging,
+			gDevice.DeviceGroup,
+			gDevice.DeviceGroupIndex,
+			gDevice.LastModified.UTC().Format(helper.SqlDateFormat),
+			gDevice.LastConnection.UTC().Format(helper.SqlDateFormat),
+			gDevice.Status,
+		)
+		if err != nil {
+			log.Warnf("Error executing insert statement: %v", err)
+			run.Errors = append(run.Errors, fmt.Sprintf("Error saving device %s: %v", gDevice.Id, err))
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "error committing devices")
+	}
+	return nil
 }
 
-func getLoadedDevices(database *database.Database, filter string) (devices *[]models.GeneralDevice, err error) {
-	rows, _err := database.DB.Query("SELECT * FROM devices" + " " + filter)
+func GetValidLoadedDevices(ctx context.Context, database *database.Database) (devices *[]models.GeneralDevice, err error) {
+	return getLoadedDevices(ctx, database, "WHERE "+validDevicesFilter)
+}
+
+// GetFilteredDevices returns all valid devices matching the filter
+func GetFilteredDevices(ctx context.Context, database *database.Database, filter DeviceFilter) (devices *[]models.GeneralDevice, err error) {
+	where, args := filter.sql()
+	return getLoadedDevices(ctx, database, where, args...)
+}
+
+// IterateFilteredDevices calls the handler for every valid device matching the filter,
+// without loading all devices into the memory
+func IterateFilteredDevices(ctx context.Context, database *database.Database, filter DeviceFilter, handler func(device *models.GeneralDevice) error) error {
+	where, args := filter.sql()
+	return iterateDevices(ctx, database, where, args, handler)
+}
+
+func getLoadedDevices(ctx context.Context, database *database.Database, filter string, args ...interface{}) (devices *[]models.GeneralDevice, err error) {
+	var _devices []models.GeneralDevice
+	err = iterateDevices(ctx, database, filter, args, func(device *models.GeneralDevice) error {
+		_devices = append(_devices, *device)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	devices = &_devices
+
+	return devices, err
+}
+
+func iterateDevices(ctx context.Context, database *database.Database, filter string, args []interface{}, handler func(device *models.GeneralDevice) error) error {
+	rows, _err := database.DB.QueryContext(ctx, "SELECT * FROM devices"+" "+filter, args...)
 	if _err != nil {
 		log.Errorf("Database query failed: %v", _err)
-		err = &helper.LoadError{Msg: "Database query failed "}
-		return nil, err
+		return &helper.LoadError{Msg: "Database query failed "}
 	}
-	var _devices []models.GeneralDevice
 	device := &models.GeneralDevice{}
 	var modified mysql.NullTime
 	var connection mysql.NullTime
@@ -179,8 +335,7 @@ func getLoadedDevices(database *database.Database, filter string) (devices *[]mo
 		)
 		if err != nil {
 			log.Errorf("Database query failed: %v", err)
-			err = &helper.LoadError{Msg: "Database query failed"}
-			return nil, err
+			return &helper.LoadError{Msg: "Database query failed"}
 		}
 
 		// Parse the dates
@@ -195,15 +350,14 @@ func getLoadedDevices(database *database.Database, filter string) (devices *[]mo
 			log.Warnf("Cannot read last connection of device")
 		}
 
-		_devices = append(_devices, *device)
+		if err := handler(device); err != nil {
+			return err
+		}
 	}
-	err = rows.Err()
+	err := rows.Err()
 	if err != nil {
 		log.Errorf("Database query failed: %v", err)
-		err = &helper.LoadError{Msg: "Database query failed"}
-		return nil, err
+		return &helper.LoadError{Msg: "Database query failed"}
 	}
-	devices = &_devices
-
-	return devices, err
+	return nil
 }
@@ -1,18 +1,111 @@
 package relution
 
 import (
+	"context"
+	"reflect"
+
 	"github.com/gin-gonic/gin"
 
 	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/export"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+	"github.com/viktoriaschule/management-server/scheduler"
 )
 
-func Serve(root *gin.RouterGroup, database *database.Database) {
+// SyncRequest configures a manually triggered sync
+type SyncRequest struct {
+	// Wait until the sync finished and respond with its run
+	Wait bool `form:"wait"`
+}
+
+// SyncRunsRequest limits the number of listed sync runs
+type SyncRunsRequest struct {
+	Limit int `form:"limit"`
+}
+
+func Serve(root *gin.RouterGroup, admin *gin.RouterGroup, database *database.Database, jobs *scheduler.Scheduler) {
 	root.GET("/ipad_list", func(c *gin.Context) {
-		devices, err := GetValidLoadedDevices(database)
+		filter := DeviceFilter{}
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			c.JSON(400, gin.H{"error": "Wrong query format"})
+			return
+		}
+		if format := export.GetFormat(c); format != "" {
+			exportDevices(c, database, filter, format)
+			return
+		}
+		devices, err := GetFilteredDevices(c.Request.Context(), database, filter)
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 		c.JSON(200, gin.H{"devices": devices})
 	})
+
+	// Starts a sync, or joins the running one
+	admin.POST("/sync", func(c *gin.Context) {
+		request := SyncRequest{}
+		if err := c.ShouldBindQuery(&request); err != nil {
+			c.JSON(400, gin.H{"error": "Wrong query format"})
+			return
+		}
+		execution, started, err := jobs.Trigger(SyncJob)
+		if err != nil {
+			c.JSON(503, gin.H{"error": err.Error()})
+			return
+		}
+		if !request.Wait {
+			c.JSON(202, gin.H{"started": started})
+			return
+		}
+
+		select {
+		case <-execution.Done():
+		case <-c.Request.Context().Done():
+			// The request timed out, but the sync keeps running like without waiting
+			c.JSON(202, gin.H{"started": started})
+			return
+		}
+		// The run of this execution, not the latest saved one, which may belong to a newer sync
+		run, _ := execution.Result().(*models.SyncRun)
+		c.JSON(200, gin.H{"started": started, "run": run})
+	})
+
+	admin.GET("/sync/runs", func(c *gin.Context) {
+		request := SyncRunsRequest{}
+		if err := c.ShouldBindQuery(&request); err != nil {
+			c.JSON(400, gin.H{"error": "Wrong query format"})
+			return
+		}
+		runs, err := GetSyncRuns(c.Request.Context(), database, request.Limit)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"runs": runs})
+	})
+}
+
+// Streams all devices matching the filter as the export format
+func exportDevices(c *gin.Context, database *database.Database, filter DeviceFilter, format string) {
+	writer, ok := export.StartResponse(c, "devices", format)
+	if !ok {
+		return
+	}
+	if err := ExportDevices(c.Request.Context(), database, filter, writer); err != nil {
+		log.Warnf("Error exporting devices: %v", err)
+	}
+}
+
+// ExportDevices writes all devices matching the filter to the export writer and closes it
+func ExportDevices(ctx context.Context, database *database.Database, filter DeviceFilter, writer export.Writer) error {
+	table := export.NewTableWriter(writer, reflect.TypeOf(models.GeneralDevice{}))
+	err := IterateFilteredDevices(ctx, database, filter, func(device *models.GeneralDevice) error {
+		return table.Write(device)
+	})
+	if err != nil {
+		return err
+	}
+	return table.Close()
 }
@@ -0,0 +1,91 @@
+package relution
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+// The number of days sync runs are kept
+const syncRunRetentionDays = 30
+
+// The max number of sync runs returned at once
+const maxSyncRunsLimit = 500
+
+// Saves a finished sync run and removes the expired runs
+func addSyncRun(database *database.Database, run *models.SyncRun) {
+	errors, err := json.Marshal(run.Errors)
+	if err != nil {
+		log.Warnf("Error encoding sync run errors: %v", err)
+	}
+	// Not bound to the sync context, so canceled syncs are saved as well
+	result, err := database.DB.Exec(
+		"INSERT INTO sync_runs (start, end, devices_seen, devices_changed, history_entries, errors) VALUES (?, ?, ?, ?, ?, ?)",
+		run.Start.UTC().Format(helper.SqlDateFormat),
+		run.End.UTC().Format(helper.SqlDateFormat),
+		run.DevicesSeen,
+		run.DevicesChanged,
+		run.HistoryEntries,
+		string(errors),
+	)
+	if err != nil {
+		log.Warnf("Error adding sync run: %v", err)
+		return
+	}
+	if run.Id, err = result.LastInsertId(); err != nil {
+		log.Warnf("Error reading sync run id: %v", err)
+	}
+
+	oldestDate := time.Now().UTC().AddDate(0, 0, -syncRunRetentionDays).Format(helper.SqlDateFormat)
+	if _, err = database.DB.Exec("DELETE FROM sync_runs WHERE start < ?", oldestDate); err != nil {
+		log.Warnf("Error deleting old sync runs: %v", err)
+	}
+}
+
+// GetSyncRuns returns the latest sync runs, newest first
+func GetSyncRuns(ctx context.Context, database *database.Database, limit int) ([]models.SyncRun, error) {
+	if limit <= 0 || limit > maxSyncRunsLimit {
+		limit = maxSyncRunsLimit
+	}
+	rows, _err := database.DB.QueryContext(ctx, "SELECT id, start, end, devices_seen, devices_changed, history_entries, errors FROM sync_runs ORDER BY start DESC, id DESC LIMIT ?", limit)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	runs := []models.SyncRun{}
+	for rows.Next() {
+		run := models.SyncRun{}
+		var start, end mysql.NullTime
+		var errors string
+		err := rows.Scan(&run.Id, &start, &end, &run.DevicesSeen, &run.DevicesChanged, &run.HistoryEntries, &errors)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		if start.Valid {
+			run.Start = start.Time
+		}
+		if end.Valid {
+			run.End = end.Time
+		}
+		if err = json.Unmarshal([]byte(errors), &run.Errors); err != nil {
+			log.Warnf("Error decoding sync run errors: %v", err)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return runs, nil
+}
@@ -1,68 +1,266 @@
 package rest
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
-	"github.com/viktoriaschule/management-server/history"
-	"os"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/viktoriaschule/management-server/apps"
+	"github.com/viktoriaschule/management-server/audit"
 	"github.com/viktoriaschule/management-server/auth"
+	"github.com/viktoriaschule/management-server/changes"
+	"github.com/viktoriaschule/management-server/compliance"
 	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/connection"
 	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/details"
+	"github.com/viktoriaschule/management-server/export"
+	"github.com/viktoriaschule/management-server/groups"
+	"github.com/viktoriaschule/management-server/health"
+	"github.com/viktoriaschule/management-server/history"
+	"github.com/viktoriaschule/management-server/lending"
 	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/metrics"
+	"github.com/viktoriaschule/management-server/osupdate"
 	"github.com/viktoriaschule/management-server/relution"
+	"github.com/viktoriaschule/management-server/scheduler"
+	"github.com/viktoriaschule/management-server/storage"
+	"github.com/viktoriaschule/management-server/usage"
 )
 
-func Serve(config *config.Config, database *database.Database) {
+// NewServer returns the server of the API, which is started with ListenAndServe and stopped with Shutdown.
+// The settings that require a restart are read once, all others from the current config of the reloader
+func NewServer(database *database.Database, jobs *scheduler.Scheduler, reloader *config.Reloader) *Server {
+	c := reloader.Config()
+	getConfig := reloader.Config
 	r := gin.New()
 	r.Use(gin.Recovery())
-	if log.Level >= log.Debug {
+	if log.GetLevel() >= log.Debug {
 		r.Use(gin.Logger())
 	}
+	// Before the authentication, because preflight requests have no credentials
+	r.Use(securityHeaders(getConfig), limitBody(getConfig), limitDuration(getConfig), cors(getConfig))
+
+	// Registered before the audit middleware, so scrapes and probes are not audited.
+	// The metrics contain device data and require an admin, the probes are public
+	metrics.Serve(r.Group("/", basicAuth(getConfig), requireAdmin()), database, relution.GetValidLoadedDevices)
+	health.Serve(r, database, getConfig, relution.SyncSchedule, relution.LastSuccessfulSync)
 
-	root := r.Group("/", basicAuth(config))
+	r.Use(audit.Middleware(database))
 
-	relution.Serve(root, database)
+	root := r.Group("/", basicAuth(getConfig))
+	staff := root.Group("/", requireTeacher())
+	admin := root.Group("/", requireAdmin())
+
+	relution.Serve(root, admin, database, jobs)
 	history.Serve(root, database)
+	apps.Serve(root, database, getConfig, relution.GetValidLoadedDevices)
+	changes.Serve(root, database)
+	compliance.Serve(root, database, relution.GetValidLoadedDevices)
+	connection.Serve(root, database, relution.GetValidLoadedDevices)
+	details.Serve(root, database)
+	groups.Serve(root, admin, database)
+	lending.Serve(staff, database)
+	osupdate.Serve(root, admin, database, getConfig, relution.GetValidLoadedDevices)
+	storage.Serve(root, database, getConfig, relution.GetValidLoadedDevices)
+	usage.Serve(staff, database)
+	audit.Serve(admin, database)
+	scheduler.Serve(admin, jobs)
+	config.Serve(admin, reloader)
+
+	server := &Server{
+		api: &http.Server{
+			Addr:           fmt.Sprintf(":%d", c.Port),
+			Handler:        r,
+			ReadTimeout:    c.Server.ReadTimeout,
+			WriteTimeout:   c.Server.WriteTimeout,
+			IdleTimeout:    c.Server.IdleTimeout,
+			MaxHeaderBytes: c.Server.MaxHeaderBytes,
+		},
+		config: c,
+	}
+	if c.Tls.Cert != "" && c.Tls.RedirectPort != 0 {
+		server.redirect = newRedirectServer(c)
+	}
+	return server
+}
+
+// Sets the headers that disable sniffing, framing, caching and referrers for all responses
+// and enforces HTTPS if TLS is enabled
+func securityHeaders(getConfig func() *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		config := getConfig()
+		header := c.Writer.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		header.Set("Referrer-Policy", "no-referrer")
+		header.Set("Cache-Control", "no-store")
+		if config.Tls.Cert != "" {
+			header.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+
+		c.Next()
+	}
+}
+
+// Allows the configured origins to call the API from browsers and answers preflight requests
+func cors(getConfig func() *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := getConfig().Cors
+		if len(settings.AllowedOrigins) == 0 {
+			c.Next()
+			return
+		}
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		allowed := false
+		for _, allowedOrigin := range settings.AllowedOrigins {
+			if allowedOrigin == "*" || strings.EqualFold(allowedOrigin, origin) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			c.Next()
+			return
+		}
+
+		header.Set("Access-Control-Allow-Origin", origin)
+		// Browsers hide all other headers from scripts, but clients need the file name of exports
+		header.Set("Access-Control-Expose-Headers", "Content-Disposition")
+		if settings.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if c.Request.Method != "OPTIONS" || c.GetHeader("Access-Control-Request-Method") == "" {
+			c.Next()
+			return
+		}
+		header.Set("Access-Control-Allow-Methods", strings.Join(settings.AllowedMethods, ", "))
+		header.Set("Access-Control-Allow-Headers", strings.Join(settings.AllowedHeaders, ", "))
+		if settings.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(settings.MaxAge.Seconds())))
+		}
+		c.AbortWithStatus(204)
+	}
+}
+
+// Rejects request bodies that exceed the configured maximum size
+func limitBody(getConfig func() *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := getConfig().Server.MaxBodyBytes
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > limit {
+			respondWithError(413, "Request body too large", c)
+			return
+		}
+		if c.Request.ContentLength < 0 {
+			// Bodies without a content length (e.g. chunked) are read here, because the handlers
+			// cannot distinguish a too large body from an invalid one
+			body, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+			if err != nil {
+				respondWithError(400, "Cannot read request body", c)
+				return
+			}
+			if int64(len(body)) > limit {
+				respondWithError(413, "Request body too large", c)
+				return
+			}
+			c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+			c.Request.ContentLength = int64(len(body))
+		}
 
-	err := r.Run(fmt.Sprintf(":%d", config.Port))
-	if err != nil {
-		log.Errorf("Error serving API: %v", err)
-		os.Exit(1)
+		c.Next()
 	}
 }
 
-func basicAuth(config *config.Config) gin.HandlerFunc {
+// Cancels the request context after the configured request timeout, except for exports,
+// which are streamed and would be cut off
+func limitDuration(getConfig func() *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		auth := strings.SplitN(c.Request.Header.Get("Authorization"), " ", 2)
+		timeout := getConfig().Server.RequestTimeout
+		if timeout <= 0 || export.GetFormat(c) != "" {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
 
-		if len(auth) != 2 || auth[0] != "Basic" {
+		c.Next()
+	}
+}
+
+func basicAuth(getConfig func() *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := strings.SplitN(c.Request.Header.Get("Authorization"), " ", 2)
+
+		if len(header) != 2 || header[0] != "Basic" {
 			c.Writer.Header().Set("WWW-Authenticate", "Basic")
 			respondWithError(401, "Unauthorized", c)
 			return
 		}
-		payload, _ := base64.StdEncoding.DecodeString(auth[1])
+		payload, _ := base64.StdEncoding.DecodeString(header[1])
 		pair := strings.SplitN(string(payload), ":", 2)
 
-		if len(pair) != 2 || !authenticateUser(pair[0], pair[1], config) {
+		if len(pair) != 2 {
 			c.Writer.Header().Set("WWW-Authenticate", "Basic")
 			respondWithError(401, "Unauthorized", c)
 			return
 		}
+		user, err := auth.CheckUser(c.Request.Context(), pair[0], pair[1], getConfig())
+		if err != nil {
+			log.With("method", c.Request.Method, "path", c.Request.URL.Path, "user", pair[0]).Errorf("%v", err)
+			respondWithError(502, "Authentication failed", c)
+			return
+		}
+		if user == nil {
+			c.Writer.Header().Set("WWW-Authenticate", "Basic")
+			respondWithError(401, "Unauthorized", c)
+			return
+		}
+		auth.SetUser(c, user)
+
+		c.Next()
+	}
+}
+
+func requireTeacher() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user := auth.GetUser(c); user == nil || !(user.IsTeacher || user.IsAdmin) {
+			respondWithError(403, "Forbidden", c)
+			return
+		}
 
 		c.Next()
 	}
 }
 
-func authenticateUser(username, password string, config *config.Config) bool {
-	result, err := auth.CheckUser(username, password, config)
-	if err != nil {
-		log.Errorf("%v", err)
+func requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user := auth.GetUser(c); user == nil || !user.IsAdmin {
+			respondWithError(403, "Forbidden", c)
+			return
+		}
+
+		c.Next()
 	}
-	return result
 }
 
 func respondWithError(code int, message string, c *gin.Context) {
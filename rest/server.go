@@ -0,0 +1,76 @@
+package rest
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/log"
+)
+
+// Server serves the API over HTTP, or over HTTPS if a certificate is configured
+// with an optional HTTP server that redirects to HTTPS
+type Server struct {
+	api      *http.Server
+	redirect *http.Server
+	config   *config.Config
+}
+
+// ListenAndServe serves the API until the server is shut down, which returns http.ErrServerClosed
+func (s *Server) ListenAndServe() error {
+	if s.config.Tls.Cert == "" {
+		return s.api.ListenAndServe()
+	}
+	certificates, err := newCertificateLoader(s.config.Tls.Cert, s.config.Tls.Key)
+	if err != nil {
+		return err
+	}
+	s.api.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certificates.getCertificate,
+	}
+	if s.redirect != nil {
+		go func() {
+			if err := s.redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Errorf("Error serving HTTPS redirect: %v", err)
+			}
+		}()
+	}
+	return s.api.ListenAndServeTLS("", "")
+}
+
+// Shutdown stops accepting requests and waits for the running requests until the context is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.redirect != nil {
+		if err := s.redirect.Shutdown(ctx); err != nil {
+			log.Warnf("Failed to stop HTTPS redirect: %v", err)
+		}
+	}
+	return s.api.Shutdown(ctx)
+}
+
+// Returns a plain HTTP server that redirects all requests to the HTTPS port
+func newRedirectServer(c *config.Config) *http.Server {
+	port := strconv.Itoa(c.Port)
+	return &http.Server{
+		Addr: ":" + strconv.Itoa(c.Tls.RedirectPort),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if port != "443" {
+				host = net.JoinHostPort(host, port)
+			}
+			// Permanent redirects keep the method and body of the request
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+		}),
+		ReadTimeout:    c.Server.ReadTimeout,
+		WriteTimeout:   c.Server.WriteTimeout,
+		IdleTimeout:    c.Server.IdleTimeout,
+		MaxHeaderBytes: c.Server.MaxHeaderBytes,
+	}
+}
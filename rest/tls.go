@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/viktoriaschule/management-server/log"
+)
+
+// How often the certificate files are checked for renewals
+const certificateCheckInterval = time.Second * 10
+
+// Loads the certificate and reloads it when one of the files changed, e.g. after a renewal
+type certificateLoader struct {
+	certFile    string
+	keyFile     string
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	modTime     time.Time
+	checked     time.Time
+}
+
+func newCertificateLoader(certFile string, keyFile string) (*certificateLoader, error) {
+	loader := &certificateLoader{certFile: certFile, keyFile: keyFile}
+	if err := loader.load(); err != nil {
+		return nil, err
+	}
+	return loader, nil
+}
+
+// Returns the latest modification time of both files
+func (l *certificateLoader) lastModified() (time.Time, error) {
+	var modTime time.Time
+	for _, path := range []string{l.certFile, l.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+func (l *certificateLoader) load() error {
+	modTime, err := l.lastModified()
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return err
+	}
+	l.certificate = &certificate
+	l.modTime = modTime
+	l.checked = time.Now()
+	return nil
+}
+
+// Returns the current certificate, if the renewed files cannot be loaded, the last certificate is kept
+func (l *certificateLoader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if time.Since(l.checked) < certificateCheckInterval {
+		return l.certificate, nil
+	}
+	l.checked = time.Now()
+	modTime, err := l.lastModified()
+	if err != nil {
+		log.Warnf("Cannot check certificate %s: %v", l.certFile, err)
+		return l.certificate, nil
+	}
+	if modTime.Equal(l.modTime) {
+		return l.certificate, nil
+	}
+	if err := l.load(); err != nil {
+		// The files may be replaced one after another, so they are retried on the next check
+		log.Warnf("Cannot reload certificate %s: %v", l.certFile, err)
+		return l.certificate, nil
+	}
+	log.Infof("Reloaded certificate %s", l.certFile)
+	return l.certificate, nil
+}
@@ -0,0 +1,114 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int, hour int, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		expression string
+		from       time.Time
+		expected   time.Time
+	}{
+		// Steps
+		{"*/15 * * * *", date(2020, 5, 4, 10, 0), date(2020, 5, 4, 10, 15)},
+		{"*/15 * * * *", date(2020, 5, 4, 10, 50), date(2020, 5, 4, 11, 0)},
+		{"5/20 * * * *", date(2020, 5, 4, 10, 26), date(2020, 5, 4, 10, 45)},
+		{"0 */6 * * *", date(2020, 5, 4, 13, 0), date(2020, 5, 4, 18, 0)},
+		// Ranges and lists
+		{"30 6-18 * * *", date(2020, 5, 4, 18, 30), date(2020, 5, 5, 6, 30)},
+		{"0 8,12,16 * * *", date(2020, 5, 4, 12, 0), date(2020, 5, 4, 16, 0)},
+		{"0 9-17/4 * * *", date(2020, 5, 4, 10, 0), date(2020, 5, 4, 13, 0)},
+		// The next full minute is used, even if the time is within a minute
+		{"* * * * *", date(2020, 5, 4, 10, 0).Add(time.Second * 30), date(2020, 5, 4, 10, 1)},
+		// Weekdays (2020-05-08 is a friday)
+		{"0 7 * * 1-5", date(2020, 5, 8, 8, 0), date(2020, 5, 11, 7, 0)},
+		{"0 0 * * 7", date(2020, 5, 8, 0, 0), date(2020, 5, 10, 0, 0)},
+		{"0 0 * * 0", date(2020, 5, 8, 0, 0), date(2020, 5, 10, 0, 0)},
+		// If both day fields are restricted, any of both matches
+		{"0 0 13 * 5", date(2020, 5, 4, 0, 0), date(2020, 5, 8, 0, 0)},
+		{"0 0 13 * 5", date(2020, 5, 9, 0, 0), date(2020, 5, 13, 0, 0)},
+		// A day field with a step is not restricted, so both must match (odd days which are mondays)
+		{"0 0 */2 * 1", date(2020, 5, 4, 0, 0), date(2020, 5, 11, 0, 0)},
+		{"0 0 1 * *", date(2020, 5, 4, 0, 0), date(2020, 6, 1, 0, 0)},
+		// Month and year rollovers
+		{"0 0 31 * *", date(2020, 5, 31, 0, 0), date(2020, 7, 31, 0, 0)},
+		{"0 0 29 2 *", date(2020, 3, 1, 0, 0), date(2024, 2, 29, 0, 0)},
+		{"59 23 31 12 *", date(2020, 12, 31, 23, 59), date(2021, 12, 31, 23, 59)},
+		{"0 0 * 1 *", date(2020, 5, 4, 0, 0), date(2021, 1, 1, 0, 0)},
+		// Descriptors
+		{"@hourly", date(2020, 5, 4, 10, 30), date(2020, 5, 4, 11, 0)},
+		{"@daily", date(2020, 5, 4, 10, 30), date(2020, 5, 5, 0, 0)},
+		{"@weekly", date(2020, 5, 4, 10, 30), date(2020, 5, 10, 0, 0)},
+		{"@monthly", date(2020, 5, 4, 10, 30), date(2020, 6, 1, 0, 0)},
+		{"@yearly", date(2020, 5, 4, 10, 30), date(2021, 1, 1, 0, 0)},
+	}
+	for _, test := range tests {
+		schedule, err := ParseCron(test.expression)
+		if err != nil {
+			t.Errorf("ParseCron(%q) returned error: %v", test.expression, err)
+			continue
+		}
+		if next := schedule.Next(test.from); !next.Equal(test.expected) {
+			t.Errorf("%q.Next(%s) = %s, expected %s", test.expression, test.from, next, test.expected)
+		}
+	}
+}
+
+func TestCronNextWithoutMatch(t *testing.T) {
+	schedule, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := schedule.Next(date(2020, 1, 1, 0, 0)); !next.IsZero() {
+		t.Errorf("Expected no next run, got %s", next)
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"@never",
+	} {
+		if _, err := ParseCron(expression); err == nil {
+			t.Errorf("ParseCron(%q) expected an error", expression)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	schedule, err := Parse(0, "", time.Hour)
+	if err != nil || schedule.String() != "every 1h0m0s" {
+		t.Errorf("Expected the default interval, got %v (%v)", schedule, err)
+	}
+	schedule, err = Parse(time.Minute*5, "", time.Hour)
+	if err != nil || schedule.String() != "every 5m0s" {
+		t.Errorf("Expected the interval, got %v (%v)", schedule, err)
+	}
+	schedule, err = Parse(0, "@daily", time.Hour)
+	if err != nil || schedule.String() != "@daily" {
+		t.Errorf("Expected the cron schedule, got %v (%v)", schedule, err)
+	}
+	if _, err = Parse(time.Minute, "@daily", time.Hour); err == nil {
+		t.Errorf("Expected an error for an interval combined with cron")
+	}
+	if _, err = Parse(-time.Minute, "", time.Hour); err == nil {
+		t.Errorf("Expected an error for a negative interval")
+	}
+}
@@ -0,0 +1,48 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// Schedule returns the next run time after the given time, or zero if there is none
+type Schedule interface {
+	Next(t time.Time) time.Time
+	String() string
+}
+
+// Interval is a schedule that runs directly and then after each interval
+type Interval struct {
+	interval time.Duration
+}
+
+// Every returns a schedule that runs directly on start and then repeatedly after the interval
+func Every(interval time.Duration) Schedule {
+	return &Interval{interval: interval}
+}
+
+func (s *Interval) Next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
+
+func (s *Interval) String() string {
+	return "every " + s.interval.String()
+}
+
+// Parse returns the schedule of either an interval or a cron expression,
+// the default interval is used if none of them is set
+func Parse(interval time.Duration, cron string, defaultInterval time.Duration) (Schedule, error) {
+	if cron != "" {
+		if interval != 0 {
+			return nil, fmt.Errorf("interval and cron cannot be combined")
+		}
+		return ParseCron(cron)
+	}
+	if interval < 0 {
+		return nil, fmt.Errorf("interval must be positive")
+	}
+	if interval == 0 {
+		interval = defaultInterval
+	}
+	return Every(interval), nil
+}
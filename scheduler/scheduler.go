@@ -0,0 +1,276 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+	"github.com/viktoriaschule/management-server/schedule"
+)
+
+// Job is executed by the scheduler, the context is canceled when the scheduler is stopped
+type Job func(ctx context.Context) error
+
+// Execution is a single run of a job
+type Execution struct {
+	done   chan bool
+	result interface{}
+}
+
+// Done returns the channel that is closed when the execution finished
+func (e *Execution) Done() <-chan bool {
+	return e.done
+}
+
+// Result returns the result published by the job with SetResult, it is only set after Done is closed
+func (e *Execution) Result() interface{} {
+	return e.result
+}
+
+type executionKey struct{}
+
+// SetResult publishes the result of the execution that runs with the context, e.g. to the request that triggered it.
+// Contexts that do not belong to an execution are ignored
+func SetResult(ctx context.Context, result interface{}) {
+	if execution, ok := ctx.Value(executionKey{}).(*Execution); ok {
+		execution.result = result
+	}
+}
+
+type job struct {
+	name     string
+	schedule schedule.Schedule
+	jitter   time.Duration
+	run      Job
+	reload   chan bool
+
+	// Guarded by the scheduler mutex
+	running   bool
+	execution *Execution
+	status    models.JobStatus
+	nextRun   time.Time
+}
+
+// Scheduler runs registered jobs on their schedules, a job never runs concurrently with itself
+type Scheduler struct {
+	mutex   sync.Mutex
+	jobs    map[string]*job
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stop    chan bool
+	stopped bool
+	// Guarded by the mutex, seeded per scheduler, because the global source is not seeded before go 1.20
+	random  *rand.Rand
+	loops   sync.WaitGroup
+	running sync.WaitGroup
+}
+
+func NewScheduler() *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		jobs:   map[string]*job{},
+		ctx:    ctx,
+		cancel: cancel,
+		stop:   make(chan bool),
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Add registers a job and starts its schedule, each run is delayed by a random duration up to the jitter
+func (s *Scheduler) Add(name string, jobSchedule schedule.Schedule, jitter time.Duration, run Job) {
+	j := &job{
+		name:     name,
+		schedule: jobSchedule,
+		jitter:   jitter,
+		run:      run,
+		reload:   make(chan bool, 1),
+		status:   models.JobStatus{Name: name, Schedule: jobSchedule.String()},
+	}
+	s.mutex.Lock()
+	s.jobs[name] = j
+	s.mutex.Unlock()
+
+	s.loops.Add(1)
+	go s.loop(j)
+}
+
+func (s *Scheduler) loop(j *job) {
+	defer s.loops.Done()
+
+	// Interval jobs run directly on start, cron jobs on their next match
+	s.mutex.Lock()
+	next := time.Now()
+	if _, ok := j.schedule.(*schedule.Interval); !ok {
+		next = j.schedule.Next(next)
+	}
+	s.mutex.Unlock()
+	for {
+		if next.IsZero() {
+			log.Warnf("Job %s has no next run", j.name)
+			return
+		}
+		s.mutex.Lock()
+		if j.jitter > 0 {
+			next = next.Add(time.Duration(s.random.Int63n(int64(j.jitter))))
+		}
+		j.nextRun = next
+		s.mutex.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			if execution := s.start(j); execution != nil {
+				<-execution.Done()
+			} else {
+				log.Debugf("Skipping job %s, because it is still running", j.name)
+			}
+		case <-j.reload:
+			timer.Stop()
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+
+		s.mutex.Lock()
+		jobSchedule := j.schedule
+		s.mutex.Unlock()
+		next = jobSchedule.Next(time.Now())
+	}
+}
+
+// Starts a run of the job and returns its execution, or nil if the job is already running
+func (s *Scheduler) start(j *job) *Execution {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if j.running || s.stopped {
+		return nil
+	}
+	j.running = true
+	execution := &Execution{done: make(chan bool)}
+	j.execution = execution
+	j.status.LastStart = time.Now()
+	s.running.Add(1)
+
+	go func() {
+		defer s.running.Done()
+		err := s.execute(j, execution)
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		j.running = false
+		j.status.LastEnd = time.Now()
+		j.status.Runs++
+		j.status.LastError = ""
+		if err != nil {
+			j.status.LastError = err.Error()
+			j.status.Failures++
+		}
+		close(execution.done)
+	}()
+	return execution
+}
+
+// Executes the job and converts panics to errors
+func (s *Scheduler) execute(j *job, execution *Execution) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Job %s panicked: %v\n%s", j.name, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	err = j.run(context.WithValue(s.ctx, executionKey{}, execution))
+	if err != nil {
+		log.Errorf("Job %s failed: %v", j.name, err)
+	}
+	return err
+}
+
+// Trigger runs the job directly unless it is already running and returns if a new execution was started.
+// The returned execution is either the started or the already running one
+func (s *Scheduler) Trigger(name string) (execution *Execution, started bool, err error) {
+	s.mutex.Lock()
+	j, ok := s.jobs[name]
+	s.mutex.Unlock()
+	if !ok {
+		return nil, false, fmt.Errorf("unknown job %s", name)
+	}
+	if execution := s.start(j); execution != nil {
+		return execution, true, nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopped {
+		return nil, false, fmt.Errorf("scheduler is stopped")
+	}
+	return j.execution, false, nil
+}
+
+// SetSchedule replaces the schedule of a job if it changed, the next run is then calculated from now
+func (s *Scheduler) SetSchedule(name string, jobSchedule schedule.Schedule, jitter time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return fmt.Errorf("unknown job %s", name)
+	}
+	if j.schedule.String() == jobSchedule.String() && j.jitter == jitter {
+		return nil
+	}
+	j.schedule = jobSchedule
+	j.jitter = jitter
+	j.status.Schedule = jobSchedule.String()
+	select {
+	case j.reload <- true:
+	default:
+	}
+	return nil
+}
+
+// Status returns the status of all registered jobs sorted by their names
+func (s *Scheduler) Status() []models.JobStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	statuses := make([]models.JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		status := j.status
+		status.Running = j.running
+		if !j.running {
+			status.NextRun = j.nextRun
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Stop stops all schedules and waits for the running jobs.
+// If the context is done before, the running jobs are canceled
+func (s *Scheduler) Stop(ctx context.Context) {
+	s.mutex.Lock()
+	s.stopped = true
+	s.mutex.Unlock()
+	close(s.stop)
+
+	stopped := make(chan bool)
+	go func() {
+		s.loops.Wait()
+		s.running.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Warnf("Canceling running jobs")
+		s.cancel()
+		<-stopped
+	}
+	s.cancel()
+}
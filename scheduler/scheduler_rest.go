@@ -0,0 +1,11 @@
+package scheduler
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Serve(admin *gin.RouterGroup, scheduler *Scheduler) {
+	admin.GET("/jobs", func(c *gin.Context) {
+		c.JSON(200, gin.H{"jobs": scheduler.Status()})
+	})
+}
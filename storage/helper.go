@@ -0,0 +1,16 @@
+package storage
+
+import "time"
+
+// The default duration to store storage changes (30d), the latest entry of a device is always kept
+const defaultRetentionDays = 30
+
+// The min change of the available capacity in GB to add a storage entry
+const minCapacityChange = 0.1
+
+// The default min free storage in percent before a device is nearly full
+const defaultMinFreePercent = 10
+
+type HistoryRequest struct {
+	From time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+}
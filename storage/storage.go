@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+// The latest storage entries of all devices
+var oldEntries map[string]models.StorageEntry
+
+// The changed storage entries of the current sync
+var changedEntries []models.StorageEntry
+
+// Prepares the storage synchronization
+func StartSync(ctx context.Context, database *database.Database) {
+	changedEntries = []models.StorageEntry{}
+
+	var err error
+	oldEntries, err = getLatestEntries(ctx, database)
+	if err != nil {
+		log.Warnf("Error during fetching old storage entries: %v", err)
+		oldEntries = map[string]models.StorageEntry{}
+	}
+}
+
+// Adds a storage entry if the available capacity of the device has changed
+func SyncDevice(device *models.GeneralDevice, rDevice *models.RelutionDevice) {
+	entry := models.StorageEntry{
+		Id:        device.Id,
+		Capacity:  rDevice.Details.DeviceCapacity,
+		Available: rDevice.Details.AvailableDeviceCapacity,
+		Timestamp: time.Now(),
+	}
+	if entry.Capacity == 0 {
+		return
+	}
+	old, exists := oldEntries[device.Id]
+	if !exists || old.Capacity != entry.Capacity || math.Abs(old.Available-entry.Available) >= minCapacityChange {
+		changedEntries = append(changedEntries, entry)
+	}
+}
+
+// Stores all changed storage entries and removes all the too old entries
+func EndSync(ctx context.Context, database *database.Database, config *config.Config) error {
+	var lastErr error
+	failed := 0
+	for _, entry := range changedEntries {
+		_, err := database.DB.ExecContext(ctx,
+			"INSERT INTO storage_history VALUES (?, ?, ?, ?)",
+			entry.Id,
+			entry.Capacity,
+			entry.Available,
+			entry.Timestamp.UTC().Format(helper.SqlDateFormat),
+		)
+		if err != nil {
+			log.Warnf("Error adding storage entry: %v", err)
+			lastErr = err
+			failed++
+		}
+	}
+	if len(changedEntries) > 0 {
+		log.Debugf("Added %d storage entries", len(changedEntries))
+	}
+
+	if err := removeOldEntries(ctx, database, config); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("error adding %d of %d storage entries: %v", failed, len(changedEntries), lastErr)
+	}
+	return nil
+}
+
+// Removes all storage entries older than the configured retention except the latest entry of each device,
+// because entries are only added on changes and the latest one is the current storage of the device
+func removeOldEntries(ctx context.Context, database *database.Database, config *config.Config) error {
+	days := config.Storage.RetentionDays
+	if days <= 0 {
+		days = defaultRetentionDays
+	}
+	oldestDate := time.Now().UTC().AddDate(0, 0, -days).Format(helper.SqlDateFormat)
+	_, err := database.DB.ExecContext(ctx,
+		"DELETE s FROM storage_history s JOIN (SELECT id, MAX(timestamp) AS latest FROM storage_history GROUP BY id) l ON s.id = l.id WHERE s.timestamp < ? AND s.timestamp < l.latest",
+		oldestDate,
+	)
+	if err != nil {
+		log.Warnf("Error deleting old storage entries: %v", err)
+		return fmt.Errorf("error deleting old storage entries: %v", err)
+	}
+	return nil
+}
+
+// IsNearlyFull returns if the free storage is below the configured thresholds
+func IsNearlyFull(config *config.Config, capacity float64, available float64) bool {
+	minFreePercent := config.Storage.MinFreePercent
+	if minFreePercent <= 0 {
+		minFreePercent = defaultMinFreePercent
+	}
+	if capacity > 0 && available/capacity*100 < minFreePercent {
+		return true
+	}
+	return config.Storage.MinFreeGb > 0 && available < config.Storage.MinFreeGb
+}
+
+// GetStorageReport returns the storage of all devices sorted by the free space,
+// if onlyNearlyFull is set, only the nearly full devices are returned
+func GetStorageReport(ctx context.Context, database *database.Database, config *config.Config, devices []models.GeneralDevice, onlyNearlyFull bool) ([]models.StorageReportEntry, error) {
+	entries, err := getLatestEntries(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	report := []models.StorageReportEntry{}
+	for _, device := range devices {
+		entry, exists := entries[device.Id]
+		if !exists {
+			continue
+		}
+		reportEntry := models.StorageReportEntry{
+			Device:     device,
+			Capacity:   entry.Capacity,
+			Available:  entry.Available,
+			NearlyFull: IsNearlyFull(config, entry.Capacity, entry.Available),
+		}
+		if entry.Capacity > 0 {
+			reportEntry.FreePercent = entry.Available / entry.Capacity * 100
+		}
+		if !onlyNearlyFull || reportEntry.NearlyFull {
+			report = append(report, reportEntry)
+		}
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Available < report[j].Available
+	})
+	return report, nil
+}
+
+// GetStorageHistory returns all storage entries of the device since the given date, newest first
+func GetStorageHistory(ctx context.Context, database *database.Database, id string, from time.Time) ([]models.StorageEntry, error) {
+	return getEntries(ctx, database, "SELECT * FROM storage_history WHERE id = ? AND timestamp >= ? ORDER BY timestamp DESC", id, from.UTC().Format(helper.SqlDateFormat))
+}
+
+// Returns the latest storage entry of all devices
+func getLatestEntries(ctx context.Context, database *database.Database) (map[string]models.StorageEntry, error) {
+	entries, err := getEntries(ctx, database, "SELECT h.* FROM storage_history h INNER JOIN (SELECT id, MAX(timestamp) AS timestamp FROM storage_history GROUP BY id) latest ON h.id = latest.id AND h.timestamp = latest.timestamp")
+	if err != nil {
+		return nil, err
+	}
+	latest := map[string]models.StorageEntry{}
+	for _, entry := range entries {
+		latest[entry.Id] = entry
+	}
+	return latest, nil
+}
+
+func getEntries(ctx context.Context, database *database.Database, query string, args ...interface{}) ([]models.StorageEntry, error) {
+	rows, _err := database.DB.QueryContext(ctx, query, args...)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	entries := []models.StorageEntry{}
+	for rows.Next() {
+		entry := models.StorageEntry{}
+		var timestamp mysql.NullTime
+		err := rows.Scan(&entry.Id, &entry.Capacity, &entry.Available, &timestamp)
+		if err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		if timestamp.Valid {
+			entry.Timestamp = timestamp.Time
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return entries, nil
+}
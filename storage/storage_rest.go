@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/viktoriaschule/management-server/config"
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/export"
+	"github.com/viktoriaschule/management-server/models"
+)
+
+func Serve(root *gin.RouterGroup, database *database.Database, getConfig func() *config.Config, getDevices func(context.Context, *database.Database) (*[]models.GeneralDevice, error)) {
+	serveReport := func(c *gin.Context, onlyNearlyFull bool) {
+		devices, err := getDevices(c.Request.Context(), database)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		report, err := GetStorageReport(c.Request.Context(), database, getConfig(), *devices, onlyNearlyFull)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "devices", report)
+	}
+
+	root.GET("/storage", func(c *gin.Context) {
+		serveReport(c, false)
+	})
+
+	root.GET("/storage/full", func(c *gin.Context) {
+		serveReport(c, true)
+	})
+
+	root.GET("/devices/:id/storage/history", func(c *gin.Context) {
+		request := HistoryRequest{}
+		if err := c.ShouldBindQuery(&request); err != nil {
+			c.JSON(400, gin.H{"error": "Wrong query format"})
+			return
+		}
+		entries, err := GetStorageHistory(c.Request.Context(), database, c.Param("id"), request.From)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		export.Respond(c, "entries", entries)
+	})
+}
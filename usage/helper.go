@@ -0,0 +1,24 @@
+package usage
+
+import "time"
+
+// The scopes of the usage statistics
+const (
+	UserScope   = "user"
+	GroupScope  = "group"
+	DeviceScope = "device"
+)
+
+// The max duration between two history entries counted as usage,
+// longer gaps also start a new session
+const maxEntryGap = time.Hour
+
+// The count of past days recomputed by every run
+const recomputedDays = 1
+
+// The days are parsed in UTC like the days of the statistics
+type ReportRequest struct {
+	From time.Time `form:"from" time_format:"2006-01-02" time_utc:"1" binding:"required"`
+	To   time.Time `form:"to" time_format:"2006-01-02" time_utc:"1"`
+	Key  string    `form:"key"`
+}
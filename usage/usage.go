@@ -0,0 +1,201 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/helper"
+	"github.com/viktoriaschule/management-server/history"
+	"github.com/viktoriaschule/management-server/log"
+	"github.com/viktoriaschule/management-server/models"
+	"github.com/viktoriaschule/management-server/relution"
+)
+
+// ComputeRollups computes the usage statistics of today and the last days from the history
+func ComputeRollups(ctx context.Context, database *database.Database) error {
+	today := time.Now().UTC().Truncate(time.Hour * 24)
+	for i := recomputedDays; i >= 0; i-- {
+		if err := computeDay(ctx, database, today.AddDate(0, 0, -i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Computes and stores the usage statistics of one day per user, group and device
+func computeDay(ctx context.Context, database *database.Database, day time.Time) error {
+	log.Debugf("Compute usage statistics of %s...", day.Format("2006-01-02"))
+	entries, err := history.GetHistoryEntriesInPeriod(ctx, database, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		log.Warnf("Error loading history for usage statistics: %v", err)
+		return fmt.Errorf("error loading history for usage statistics: %v", err)
+	}
+	devices, err := relution.GetValidLoadedDevices(ctx, database)
+	if err != nil {
+		log.Warnf("Error loading devices for usage statistics: %v", err)
+		return fmt.Errorf("error loading devices for usage statistics: %v", err)
+	}
+	groups := map[string]int64{}
+	for _, device := range *devices {
+		groups[device.Id] = device.DeviceGroup
+	}
+
+	rollups := map[string]map[string]*models.UsageEntry{
+		UserScope:   {},
+		GroupScope:  {},
+		DeviceScope: {},
+	}
+	getEntry := func(scope string, key string) *models.UsageEntry {
+		entry, exists := rollups[scope][key]
+		if !exists {
+			entry = &models.UsageEntry{Day: day, Scope: scope, Key: key}
+			rollups[scope][key] = entry
+		}
+		return entry
+	}
+
+	for id, deviceEntries := range entries {
+		// The entries are sorted from the newest to the oldest
+		for i := len(deviceEntries) - 1; i > 0; i-- {
+			entry, next := deviceEntries[i], deviceEntries[i-1]
+			gap := next.Timestamp.Sub(entry.Timestamp)
+
+			scopes := []*models.UsageEntry{getEntry(DeviceScope, id)}
+			if group := groups[id]; group != 0 {
+				scopes = append(scopes, getEntry(GroupScope, strconv.FormatInt(group, 10)))
+			}
+			if entry.LoggedinUser != "" {
+				scopes = append(scopes, getEntry(UserScope, entry.LoggedinUser))
+			}
+
+			// A session starts with a new user or after a long gap
+			isNewSession := entry.LoggedinUser != "" && (i == len(deviceEntries)-1 || deviceEntries[i+1].LoggedinUser != entry.LoggedinUser || entry.Timestamp.Sub(deviceEntries[i+1].Timestamp) > maxEntryGap)
+
+			for _, scope := range scopes {
+				if entry.LoggedinUser != "" && gap <= maxEntryGap {
+					scope.LoggedInSeconds += int64(gap.Seconds())
+				}
+				if next.Level < entry.Level {
+					scope.BatteryConsumed += entry.Level - next.Level
+				}
+				if isNewSession {
+					scope.Sessions++
+				}
+			}
+		}
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Warnf("Error starting usage transaction: %v", err)
+		return fmt.Errorf("error starting usage transaction: %v", err)
+	}
+	date := day.Format(helper.SqlDateFormat)
+	if _, err = tx.ExecContext(ctx, "DELETE FROM usage_daily WHERE day = ?", date); err != nil {
+		log.Warnf("Error removing old usage statistics: %v", err)
+		_ = tx.Rollback()
+		return fmt.Errorf("error removing old usage statistics: %v", err)
+	}
+	for _, scope := range rollups {
+		for _, entry := range scope {
+			_, err = tx.ExecContext(ctx, "INSERT INTO usage_daily VALUES (?, ?, ?, ?, ?, ?)", date, entry.Scope, entry.Key, entry.LoggedInSeconds, entry.BatteryConsumed, entry.Sessions)
+			if err != nil {
+				log.Warnf("Error adding usage statistics: %v", err)
+				_ = tx.Rollback()
+				return fmt.Errorf("error adding usage statistics: %v", err)
+			}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		log.Warnf("Error committing usage statistics: %v", err)
+		return fmt.Errorf("error committing usage statistics: %v", err)
+	}
+	return nil
+}
+
+// GetReport returns the summed usage statistics of the scope in the given days per key,
+// sorted by the logged in time
+func GetReport(ctx context.Context, database *database.Database, scope string, request ReportRequest) ([]models.UsageEntry, error) {
+	to := request.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	query := "SELECT scope_key, SUM(logged_in_seconds), SUM(battery_consumed), SUM(sessions) FROM usage_daily WHERE scope = ? AND day >= ? AND day <= ?"
+	args := []interface{}{scope, request.From.UTC().Format(helper.SqlDateFormat), to.UTC().Format(helper.SqlDateFormat)}
+	if request.Key != "" {
+		query += " AND scope_key = ?"
+		args = append(args, request.Key)
+	}
+
+	rows, _err := database.DB.QueryContext(ctx, query+" GROUP BY scope_key", args...)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	entries := []models.UsageEntry{}
+	for rows.Next() {
+		entry := models.UsageEntry{Scope: scope}
+		if err := rows.Scan(&entry.Key, &entry.LoggedInSeconds, &entry.BatteryConsumed, &entry.Sessions); err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LoggedInSeconds > entries[j].LoggedInSeconds
+	})
+	return entries, nil
+}
+
+// GetDailyReport returns the usage statistics of the scope and key per day, oldest first
+func GetDailyReport(ctx context.Context, database *database.Database, scope string, request ReportRequest) ([]models.UsageEntry, error) {
+	to := request.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	rows, _err := database.DB.QueryContext(ctx,
+		"SELECT * FROM usage_daily WHERE scope = ? AND scope_key = ? AND day >= ? AND day <= ? ORDER BY day",
+		scope,
+		request.Key,
+		request.From.UTC().Format(helper.SqlDateFormat),
+		to.UTC().Format(helper.SqlDateFormat),
+	)
+	if _err != nil {
+		log.Errorf("Database query failed: %v", _err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	//noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	entries := []models.UsageEntry{}
+	for rows.Next() {
+		entry := models.UsageEntry{}
+		var day mysql.NullTime
+		if err := rows.Scan(&day, &entry.Scope, &entry.Key, &entry.LoggedInSeconds, &entry.BatteryConsumed, &entry.Sessions); err != nil {
+			log.Errorf("Database query failed: %v", err)
+			return nil, &helper.LoadError{Msg: "Database query failed"}
+		}
+		if day.Valid {
+			entry.Day = day.Time
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Database query failed: %v", err)
+		return nil, &helper.LoadError{Msg: "Database query failed"}
+	}
+	return entries, nil
+}
@@ -0,0 +1,38 @@
+package usage
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/viktoriaschule/management-server/database"
+	"github.com/viktoriaschule/management-server/export"
+)
+
+func Serve(staff *gin.RouterGroup, database *database.Database) {
+	scopes := map[string]string{
+		"/usage/users":   UserScope,
+		"/usage/groups":  GroupScope,
+		"/usage/devices": DeviceScope,
+	}
+	for path, scope := range scopes {
+		scope := scope
+		staff.GET(path, func(c *gin.Context) {
+			request := ReportRequest{}
+			if err := c.ShouldBindQuery(&request); err != nil {
+				c.JSON(400, gin.H{"error": "Wrong query format"})
+				return
+			}
+
+			// With a key, the statistics are returned per day
+			getReport := GetReport
+			if request.Key != "" {
+				getReport = GetDailyReport
+			}
+			entries, err := getReport(c.Request.Context(), database, scope, request)
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+			export.Respond(c, "usage", entries)
+		})
+	}
+}